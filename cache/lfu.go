@@ -9,14 +9,20 @@ import (
 
 	"github.com/ChainSafe/go-lfu"
 	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
 )
 
+// MaxClientsPerRecord is the maximum number of distinct clients tracked for each cid
+var MaxClientsPerRecord = 1024
+
 // LFUCache is a least frequently used cache
 type LFUCache struct {
 	cache          *lfu.Cache
 	size           int
 	insertTime     map[cid.Cid]time.Time
 	lastAccessTime map[cid.Cid]time.Time
+	prevAccessTime map[cid.Cid]time.Time
+	clients        map[cid.Cid]map[peer.ID]struct{}
 	cacheMu        sync.Mutex
 }
 
@@ -27,24 +33,62 @@ func NewLFUCache(size int) *LFUCache {
 		size:           size,
 		insertTime:     make(map[cid.Cid]time.Time),
 		lastAccessTime: make(map[cid.Cid]time.Time),
+		prevAccessTime: make(map[cid.Cid]time.Time),
+		clients:        make(map[cid.Cid]map[peer.ID]struct{}),
 	}
 }
 
 // Put adds a cid to the cache
 func (c *LFUCache) Put(cid cid.Cid) {
+	c.PutFrom(cid, "")
+}
+
+// PutFrom adds a cid requested by the given client to the cache.
+// An empty client ID is not counted as a distinct client.
+func (c *LFUCache) PutFrom(cid cid.Cid, client peer.ID) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
 	has := c.cache.Has(cid.String())
 	if !has && c.cache.Len() == c.size {
 		c.cache.Evict(1)
+		c.prune()
 	}
 
 	c.cache.Set(cid.String(), cid)
 
-	c.cacheMu.Lock()
-	defer c.cacheMu.Unlock()
-	c.lastAccessTime[cid] = time.Now()
-	if !has {
+	if has {
+		c.prevAccessTime[cid] = c.lastAccessTime[cid]
+	} else {
 		c.insertTime[cid] = time.Now()
 	}
+	c.lastAccessTime[cid] = time.Now()
+
+	if client == "" {
+		return
+	}
+
+	clients, ok := c.clients[cid]
+	if !ok {
+		clients = make(map[peer.ID]struct{})
+		c.clients[cid] = clients
+	}
+
+	if len(clients) < MaxClientsPerRecord {
+		clients[client] = struct{}{}
+	}
+}
+
+// prune removes the times and clients of evicted cids
+func (c *LFUCache) prune() {
+	for k := range c.insertTime {
+		if !c.cache.Has(k.String()) {
+			delete(c.insertTime, k)
+			delete(c.lastAccessTime, k)
+			delete(c.prevAccessTime, k)
+			delete(c.clients, k)
+		}
+	}
 }
 
 // Keys returns all the cids in the cache
@@ -70,9 +114,11 @@ func (c *LFUCache) GetRecord(cid cid.Cid) *Record {
 
 	freq := c.cache.GetFrequency(cid.String())
 	r := &Record{
-		Frequency:     freq,
-		LastAccessed:  c.lastAccessTime[cid],
-		InsertionTime: c.insertTime[cid],
+		Frequency:        freq,
+		LastAccessed:     c.lastAccessTime[cid],
+		PreviousAccessed: c.prevAccessTime[cid],
+		InsertionTime:    c.insertTime[cid],
+		Clients:          len(c.clients[cid]),
 	}
 	return r
 }
@@ -41,12 +41,14 @@ func TestGetRecord(t *testing.T) {
 		InsertionTime: c.insertTime[cid0],
 	}, r0)
 
+	first := r0.LastAccessed
 	c.Put(cid0)
 	r0 = c.GetRecord(cid0)
 	require.Equal(t, &Record{
-		Frequency:     2,
-		LastAccessed:  c.lastAccessTime[cid0],
-		InsertionTime: c.insertTime[cid0],
+		Frequency:        2,
+		LastAccessed:     c.lastAccessTime[cid0],
+		PreviousAccessed: first,
+		InsertionTime:    c.insertTime[cid0],
 	}, r0)
 	require.Greater(t, int64(r0.LastAccessed.Sub(r0.InsertionTime)), int64(0))
 }
@@ -72,3 +74,22 @@ func TestEvict(t *testing.T) {
 	require.Equal(t, []cid.Cid{cid0, cid2}, res)
 
 }
+
+func TestGetRecord_Clients(t *testing.T) {
+	c := NewLFUCache(2)
+	c.PutFrom(cid0, "client0")
+	c.PutFrom(cid0, "client1")
+	c.PutFrom(cid0, "client0")
+	c.PutFrom(cid0, "")
+
+	r0 := c.GetRecord(cid0)
+	require.Equal(t, 4, r0.Frequency)
+	require.Equal(t, 2, r0.Clients)
+
+	// evicted cids are pruned
+	c.PutFrom(cid1, "client0")
+	c.PutFrom(cid2, "client0")
+	require.NotContains(t, c.clients, cid1)
+	require.NotContains(t, c.insertTime, cid1)
+	require.Equal(t, 1, c.GetRecord(cid2).Clients)
+}
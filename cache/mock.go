@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
 )
 
 // MockCache stores up to size elements, randomly evicting when size is reached
@@ -39,6 +40,10 @@ func (c *MockCache) Put(cid cid.Cid) {
 	c.items[cid] = struct{}{}
 }
 
+func (c *MockCache) PutFrom(cid cid.Cid, client peer.ID) {
+	c.Put(cid)
+}
+
 func (c *MockCache) Keys() []cid.Cid {
 	keys := make([]cid.Cid, len(c.items))
 	i := 0
@@ -8,7 +8,9 @@ import (
 )
 
 type Record struct {
-	Frequency     int
-	LastAccessed  time.Time
-	InsertionTime time.Time
+	Frequency        int
+	LastAccessed     time.Time
+	PreviousAccessed time.Time // Time of the request before the last one, or zero if the cid was requested once
+	InsertionTime    time.Time
+	Clients          int // Number of distinct clients that requested the cid
 }
@@ -14,6 +14,8 @@ import (
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
 )
 
 var log = logging.Logger("client")
@@ -24,45 +26,73 @@ type Unsubscribe func()
 
 type Client struct {
 	net             Network
+	version         shared.Version
 	subscribersLock *sync.Mutex
-	subscribers     map[string][]ClientSubscriber
+	subscribers     map[shared.QueryID][]ClientSubscriber
+	router          routing.ContentRouting // looks up providers for QueryProviders, nil if not set
 }
 
 func NewClient(net Network) *Client {
 	c := &Client{
 		net:             net,
+		version:         shared.Versions[0],
 		subscribersLock: &sync.Mutex{},
-		subscribers:     make(map[string][]ClientSubscriber),
+		subscribers:     make(map[shared.QueryID][]ClientSubscriber),
 	}
 
-	// Register handler for provider responses
-	c.net.RegisterStreamHandler(shared.ResponseProtocolID, c.HandleProviderStream)
+	// Register handlers for provider responses in every supported version
+	for _, v := range shared.Versions {
+		c.net.RegisterStreamHandler(v.Response, c.HandleProviderStream)
+	}
 
 	return c
 }
 
-// Start starts the client's network
-func (c *Client) Start() error {
-	return c.net.Start()
+// SetVersion sets the protocol version used to submit queries. It is also the preferred version
+// when querying providers directly, falling back to older versions if the provider doesn't support it.
+// It defaults to the newest supported version.
+func (c *Client) SetVersion(v shared.Version) {
+	c.version = v
+}
+
+// Start starts the client's network, which runs until Stop is called or the context is done
+func (c *Client) Start(ctx context.Context) error {
+	return c.net.Start(ctx)
+}
+
+// Stop stops the client's network. Queries that are still collecting responses receive no more.
+func (c *Client) Stop(ctx context.Context) error {
+	return c.net.Stop(ctx)
 }
 
-// Stop stops the client's network
-func (c *Client) Stop() error {
-	return c.net.Stop()
+// SubmitQuery encodes a query and submits it to the network to be gossiped.
+// The id should be obtained with shared.NewQueryID and used to subscribe to responses
+// before the query is submitted.
+func (c *Client) SubmitQuery(ctx context.Context, id shared.QueryID, params shared.Params) error {
+	return c.SubmitQueryWithConstraints(ctx, id, params, nil)
 }
 
-// SubmitQuery encodes a query and submits it to the network to be gossiped
-func (c *Client) SubmitQuery(ctx context.Context, params shared.Params) error {
+// SubmitQueryWithConstraints submits a query like SubmitQuery, including constraints on the terms
+// the client will accept. Providers whose terms do not satisfy the constraints do not respond.
+func (c *Client) SubmitQueryWithConstraints(ctx context.Context, id shared.QueryID, params shared.Params, constraints *shared.Constraints) error {
 	query := shared.Query{
+		ID:          id,
 		Params:      params,
 		ClientAddrs: c.net.MultiAddrs(),
+		Constraints: constraints,
 	}
-	bz, err := json.Marshal(query)
+
+	err := query.Sign(c.net.PrivKey())
 	if err != nil {
 		return err
 	}
 
-	err = c.net.Publish(ctx, bz)
+	bz, err := shared.EncodeQuery(c.version.Codec, &query)
+	if err != nil {
+		return err
+	}
+
+	err = c.net.Publish(ctx, c.version.Topic, bz)
 	if err != nil {
 		return err
 	}
@@ -70,59 +100,148 @@ func (c *Client) SubmitQuery(ctx context.Context, params shared.Params) error {
 	return nil
 }
 
-// SubscribeQueryResponses registers a subscriber as a listener for a specific payload CID.
+// QueryProvider sends a query directly to the given provider instead of gossiping it, and waits for
+// the provider's response on the same stream. If the provider does not have the requested data, the
+// response has status QueryResponseUnavailable.
+func (c *Client) QueryProvider(ctx context.Context, p peer.AddrInfo, params shared.Params) (*shared.QueryResponse, error) {
+	query := shared.Query{
+		ID:          shared.NewQueryID(),
+		Params:      params,
+		ClientAddrs: c.net.MultiAddrs(),
+	}
+
+	err := query.Sign(c.net.PrivKey())
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.net.Connect(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := c.net.NewStream(ctx, p.ID, shared.QueryProtocols(c.version)...)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := shared.VersionFor(s.Protocol())
+	if !ok {
+		_ = s.Reset()
+		return nil, ErrUnknownProtocol
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = s.SetDeadline(deadline)
+		if err != nil {
+			_ = s.Reset()
+			return nil, err
+		}
+	}
+
+	err = v.Codec.EncodeQuery(s, &query)
+	if err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+
+	// close our side of the stream, the provider closes its side after responding
+	err = s.CloseWrite()
+	if err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+
+	response := new(shared.QueryResponse)
+	err = v.Codec.DecodeResponse(bufio.NewReader(s), response)
+	if err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+
+	err = response.Verify()
+	if err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+
+	if response.ID != query.ID || response.Provider != p.ID || response.Params.MustString() != params.MustString() {
+		_ = s.Reset()
+		return nil, ErrUnexpectedResponse
+	}
+
+	err = s.Close()
+	if err != nil {
+		log.Debug("failed to close query stream; error: ", err)
+	}
+
+	log.Info("Direct response received from provider ", p.ID, " with status ", response.Status)
+	return response, nil
+}
+
+// SubscribeQueryResponses registers a subscriber as a listener for responses to a specific query.
 // It returns an unsubscribe method that can be called to terminate the subscription.
-func (c *Client) SubscribeToQueryResponses(subscriber ClientSubscriber, params shared.Params) Unsubscribe {
+func (c *Client) SubscribeToQueryResponses(subscriber ClientSubscriber, id shared.QueryID) Unsubscribe {
 	c.subscribersLock.Lock()
-	str := params.MustString()
-	c.subscribers[str] = append(c.subscribers[str], subscriber)
+	c.subscribers[id] = append(c.subscribers[id], subscriber)
 	c.subscribersLock.Unlock()
 
-	return c.unsubscribeAt(subscriber, params)
+	return c.unsubscribeAt(subscriber, id)
 }
 
-// unsubscribeAt returns a function that removes an item from a CID's subscribers list by comparing
+// unsubscribeAt returns a function that removes an item from a query's subscribers list by comparing
 // their reflect.ValueOf before pulling the item out of the slice.  Does not preserve order.
 // Subsequent, repeated calls to the func with the same Subscriber are a no-op.
 // Modified from: https://github.com/filecoin-project/go-fil-markets/blob/6ca8089cea5477fd8539e70ca9b34a61ada6dc27/retrievalmarket/impl/provider.go#L139
-func (c *Client) unsubscribeAt(sub ClientSubscriber, params shared.Params) Unsubscribe {
+func (c *Client) unsubscribeAt(sub ClientSubscriber, id shared.QueryID) Unsubscribe {
 	return func() {
-		str := params.MustString()
 		c.subscribersLock.Lock()
 		defer c.subscribersLock.Unlock()
-		curLen := len(c.subscribers[str])
+		curLen := len(c.subscribers[id])
 		// Remove entry from map if last subscriber
 		if curLen == 1 {
-			delete(c.subscribers, str)
+			delete(c.subscribers, id)
 			return
 		}
 
-		for i, el := range c.subscribers[str] {
+		for i, el := range c.subscribers[id] {
 			if reflect.ValueOf(sub) == reflect.ValueOf(el) {
-				c.subscribers[str][i] = c.subscribers[str][curLen-1]
-				c.subscribers[str] = c.subscribers[str][:curLen-1]
+				c.subscribers[id][i] = c.subscribers[id][curLen-1]
+				c.subscribers[id] = c.subscribers[id][:curLen-1]
 				return
 			}
 		}
 	}
 }
 
-// HandleProviderStream reads the first message and calls HandleProviderResponse
+// HandleProviderStream reads the first message, decoding it according to the stream's protocol version,
+// and handles it as a provider response.
 // Note: implements the libp2p StreamHandler interface
 func (c *Client) HandleProviderStream(s network.Stream) {
 	log.Debug("got stream from peer ", s.Conn().RemotePeer())
 
+	v, ok := shared.VersionFor(s.Protocol())
+	if !ok {
+		log.Error("received response stream with unknown protocol ", s.Protocol())
+		_ = s.Reset()
+		return
+	}
+
 	// Read message from stream
-	buf := bufio.NewReader(s)
-	bz, err := buf.ReadBytes('\n')
+	var response shared.QueryResponse
+	err := v.Codec.DecodeResponse(bufio.NewReader(s), &response)
 	if err != nil {
+		log.Error(err)
+		_ = s.Reset()
 		return
 	}
+	_ = s.Close()
 
-	c.HandleProviderResponse(bz)
+	c.handleResponse(response)
 }
 
-// HandleProviderResponse is called to handle a QueryResponse from a provider
+// HandleProviderResponse is called to handle a JSON-encoded QueryResponse from a provider.
+// Responses that are not signed by the provider they claim to be from are dropped.
 func (c *Client) HandleProviderResponse(msg []byte) {
 	var response shared.QueryResponse
 	err := json.Unmarshal(msg, &response)
@@ -131,16 +250,26 @@ func (c *Client) HandleProviderResponse(msg []byte) {
 		return
 	}
 
-	log.Info("Response received for requested params: ", response.Params)
+	c.handleResponse(response)
+}
+
+// handleResponse verifies the response and notifies the query's subscribers
+func (c *Client) handleResponse(response shared.QueryResponse) {
+	err := response.Verify()
+	if err != nil {
+		log.Warn("dropping response from provider ", response.Provider, " with invalid signature; error: ", err)
+		return
+	}
+
+	log.Info("Response received for query ", response.ID, " with requested params: ", response.Params)
 
 	c.subscribersLock.Lock()
 	defer c.subscribersLock.Unlock()
-	str := response.Params.MustString()
-	if sub := c.subscribers[str]; sub != nil {
+	if sub := c.subscribers[response.ID]; sub != nil {
 		for _, notifyFn := range sub {
 			notifyFn(response)
 		}
 	} else {
-		log.Debug("Provider response received for unknown params: ", response.Params)
+		log.Debug("Provider response received for unknown query: ", response.ID)
 	}
 }
@@ -5,7 +5,9 @@ package client
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"os"
 	"testing"
 
@@ -14,37 +16,66 @@ import (
 	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
 	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
 )
 
-var testMultiAddr = multiaddr.StringCast("/ip4/1.2.3.4/tcp/5678/p2p/QmYyQSo1c1Ym7orWxLYvCrM2EmxFTANf8wXmmE7DWjhx5N")
+var testClientKey = mustGenerateKey()
+var testProviderKey = mustGenerateKey()
+var testMultiAddr = multiaddr.StringCast("/ip4/1.2.3.4/tcp/5678/p2p/" + mustIDFromKey(testClientKey).String())
 
 var testCid, _ = cid.Decode("bafybeierhgbz4zp2x2u67urqrgfnrnlukciupzenpqpipiz5nwtq7uxpx4")
 var testParams = shared.Params{
 	PayloadCID: testCid,
 }
 
-type mockNetwork struct{ queries []shared.Query }
+func mustGenerateKey() crypto.PrivKey {
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func mustIDFromKey(key crypto.PrivKey) peer.ID {
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+type mockNetwork struct {
+	queries   []shared.Query
+	onPublish func(query shared.Query)
+}
 
-func (n *mockNetwork) Start() error {
+func (n *mockNetwork) Start(ctx context.Context) error {
 	return nil
 }
 
-func (n *mockNetwork) Stop() error {
+func (n *mockNetwork) Stop(ctx context.Context) error {
 	return nil
 }
 
-func (n *mockNetwork) Publish(ctx context.Context, data []byte) error {
-	var query shared.Query
-	err := json.Unmarshal(data, &query)
+func (n *mockNetwork) Publish(ctx context.Context, topic core.ProtocolID, data []byte) error {
+	v, ok := shared.VersionFor(topic)
+	if !ok {
+		return errors.New("unknown topic")
+	}
+
+	query, err := shared.DecodeQuery(v.Codec, data)
 	if err != nil {
 		return err
 	}
 
-	n.queries = append(n.queries, query)
+	n.queries = append(n.queries, *query)
+	if n.onPublish != nil {
+		n.onPublish(*query)
+	}
 	return nil
 }
 
@@ -56,6 +87,18 @@ func (n *mockNetwork) MultiAddrs() []string {
 
 func (n *mockNetwork) RegisterStreamHandler(id core.ProtocolID, handler network.StreamHandler) {}
 
+func (n *mockNetwork) PrivKey() crypto.PrivKey {
+	return testClientKey
+}
+
+func (n *mockNetwork) Connect(ctx context.Context, p peer.AddrInfo) error {
+	return nil
+}
+
+func (n *mockNetwork) NewStream(ctx context.Context, p peer.ID, protocols ...core.ProtocolID) (network.Stream, error) {
+	return nil, errors.New("not implemented")
+}
+
 func TestMain(m *testing.M) {
 	lvl, err := logging.LevelFromString("debug")
 	if err != nil {
@@ -71,30 +114,44 @@ func TestClient_SubmitQuery(t *testing.T) {
 	client := NewClient(host)
 
 	query := shared.Query{
+		ID:          shared.NewQueryID(),
 		Params:      testParams,
 		ClientAddrs: []string{testMultiAddr.String()},
 	}
 
-	err := client.SubmitQuery(context.Background(), testParams)
+	err := query.Sign(testClientKey)
+	require.NoError(t, err)
+
+	err = client.SubmitQuery(context.Background(), query.ID, testParams)
 	require.NoError(t, err)
 
 	require.ElementsMatch(t, []shared.Query{query}, host.queries)
+
+	// submit the same query using the JSON protocol
+	client.SetVersion(shared.JSONVersion)
+	err = client.SubmitQuery(context.Background(), query.ID, testParams)
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, []shared.Query{query, query}, host.queries)
 }
 
 func TestClient_SubscribeToQueryResponses(t *testing.T) {
 	host := &mockNetwork{queries: []shared.Query{}}
 	client := NewClient(host)
 
-	testPeerId, err := peer.Decode("QmYyQSo1c1Ym7orWxLYvCrM2EmxFTANf8wXmmE7DWjhx5N")
-	require.NoError(t, err)
+	testPeerId := mustIDFromKey(testProviderKey)
 
+	id := shared.NewQueryID()
 	response := shared.QueryResponse{
+		ID:                      id,
 		Params:                  testParams,
 		Provider:                testPeerId,
 		PricePerByte:            provider.DefaultPricePerByte,
 		PaymentInterval:         0,
 		PaymentIntervalIncrease: 0,
 	}
+	err := response.Sign(testProviderKey)
+	require.NoError(t, err)
 
 	bz, err := json.Marshal(&response)
 	require.NoError(t, err)
@@ -112,8 +169,8 @@ func TestClient_SubscribeToQueryResponses(t *testing.T) {
 		responsesB <- resp
 	}
 
-	unsubA := client.SubscribeToQueryResponses(subscriberA, testParams)
-	unsubB := client.SubscribeToQueryResponses(subscriberB, testParams)
+	unsubA := client.SubscribeToQueryResponses(subscriberA, id)
+	unsubB := client.SubscribeToQueryResponses(subscriberB, id)
 	defer unsubB()
 
 	// Process response and wait for result
@@ -150,3 +207,94 @@ func TestClient_SubscribeToQueryResponses(t *testing.T) {
 		t.Fatal("no response received for subscriberB")
 	}
 }
+
+func TestClient_SubscribeToQueryResponses_PerQuery(t *testing.T) {
+	host := &mockNetwork{queries: []shared.Query{}}
+	client := NewClient(host)
+
+	testPeerId := mustIDFromKey(testProviderKey)
+
+	// Two queries for the same params
+	idA := shared.NewQueryID()
+	idB := shared.NewQueryID()
+	require.NotEqual(t, idA, idB)
+
+	responsesA := make(chan shared.QueryResponse, 1)
+	responsesB := make(chan shared.QueryResponse, 1)
+
+	unsubA := client.SubscribeToQueryResponses(func(resp shared.QueryResponse) {
+		responsesA <- resp
+	}, idA)
+	defer unsubA()
+	unsubB := client.SubscribeToQueryResponses(func(resp shared.QueryResponse) {
+		responsesB <- resp
+	}, idB)
+	defer unsubB()
+
+	response := shared.QueryResponse{
+		ID:           idA,
+		Params:       testParams,
+		Provider:     testPeerId,
+		PricePerByte: provider.DefaultPricePerByte,
+	}
+	err := response.Sign(testProviderKey)
+	require.NoError(t, err)
+
+	bz, err := json.Marshal(&response)
+	require.NoError(t, err)
+
+	// Only the subscriber for query A should be notified
+	client.HandleProviderResponse(bz)
+
+	select {
+	case actual := <-responsesA:
+		require.Equal(t, response, actual)
+	default:
+		t.Fatal("no response received for query A")
+	}
+
+	select {
+	case <-responsesB:
+		t.Fatal("expected no response for query B")
+	default:
+	}
+}
+
+func TestClient_HandleProviderResponse_InvalidSignature(t *testing.T) {
+	host := &mockNetwork{queries: []shared.Query{}}
+	client := NewClient(host)
+
+	id := shared.NewQueryID()
+	responses := make(chan shared.QueryResponse, 1)
+	unsub := client.SubscribeToQueryResponses(func(resp shared.QueryResponse) {
+		responses <- resp
+	}, id)
+	defer unsub()
+
+	// response claims to be from the provider but is signed by someone else
+	response := shared.QueryResponse{
+		ID:           id,
+		Params:       testParams,
+		Provider:     mustIDFromKey(testProviderKey),
+		PricePerByte: provider.DefaultPricePerByte,
+	}
+	err := response.Sign(mustGenerateKey())
+	require.NoError(t, err)
+
+	bz, err := json.Marshal(&response)
+	require.NoError(t, err)
+	client.HandleProviderResponse(bz)
+
+	// unsigned response
+	response.Key = nil
+	response.Signature = nil
+	bz, err = json.Marshal(&response)
+	require.NoError(t, err)
+	client.HandleProviderResponse(bz)
+
+	select {
+	case <-responses:
+		t.Fatal("expected response to be dropped")
+	default:
+	}
+}
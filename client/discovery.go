@@ -0,0 +1,129 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+)
+
+// SetContentRouting sets the content routing, such as a Kademlia DHT, used by FindProviders and
+// QueryProviders to look up the providers that advertise a CID
+func (c *Client) SetContentRouting(r routing.ContentRouting) {
+	c.router = r
+}
+
+// FindProviders looks up the providers that advertise the params' piece CID, if it is set, or its payload CID
+// through content routing, returning at most max providers, or every provider found until the context is
+// done if max is zero
+func (c *Client) FindProviders(ctx context.Context, params shared.Params, max int) ([]peer.AddrInfo, error) {
+	if c.router == nil {
+		return nil, ErrNoContentRouting
+	}
+
+	providers := []peer.AddrInfo{}
+	c.findProviders(ctx, params, max, func(p peer.AddrInfo) {
+		providers = append(providers, p)
+	})
+	return providers, nil
+}
+
+// findProviders calls fn with each distinct provider of the params' piece CID, if it is set, and then of
+// its payload CID, until max providers are found or, if max is zero, every lookup is done.
+// It returns the number of providers found.
+func (c *Client) findProviders(ctx context.Context, params shared.Params, max int, fn func(peer.AddrInfo)) int {
+	keys := []cid.Cid{params.PayloadCID}
+	if params.PieceCID != nil {
+		// providers advertise the piece CIDs of their stores as well as payload CIDs
+		keys = []cid.Cid{*params.PieceCID, params.PayloadCID}
+	}
+
+	seen := make(map[peer.ID]struct{})
+	for _, key := range keys {
+		for p := range c.router.FindProvidersAsync(ctx, key, max) {
+			if _, has := seen[p.ID]; has {
+				continue
+			}
+			seen[p.ID] = struct{}{}
+
+			fn(p)
+			if max > 0 && len(seen) == max {
+				return len(seen)
+			}
+		}
+	}
+	return len(seen)
+}
+
+// QueryProviders looks up the providers that advertise the params' piece CID, if it is set, or its payload CID
+// through content routing, and queries each of them directly as they are found rather than gossiping the query. Responses are collected
+// and ranked like Query, until the options' timeout, the context is done, the minimum number of responses
+// is reached, or every provider found has responded. Unlike Query, providers that no longer have the data
+// respond with status QueryResponseUnavailable, and are ranked last.
+func (c *Client) QueryProviders(ctx context.Context, params shared.Params, opts QueryOptions) ([]Result, error) {
+	if c.router == nil {
+		return nil, ErrNoContentRouting
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	// the lookup and the queries still in flight are cancelled once collection ends
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	col := newCollector(opts.MinResponses, opts.Constraints)
+	go func() {
+		select {
+		case <-col.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	found := c.findProviders(ctx, params, opts.MaxProviders, func(p peer.AddrInfo) {
+		wg.Add(1)
+		go func(p peer.AddrInfo) {
+			defer wg.Done()
+
+			resp, err := c.QueryProvider(ctx, p, params)
+			if err != nil {
+				log.Debug("failed to query provider ", p.ID, "; error: ", err)
+				return
+			}
+			col.handleResponse(*resp)
+		}(p)
+	})
+
+	queried := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(queried)
+	}()
+
+	select {
+	case <-queried:
+	case <-ctx.Done():
+	}
+
+	log.Debug("found ", found, " providers of ", params.PayloadCID)
+
+	scorer := opts.Scorer
+	if scorer == nil {
+		scorer = PriceScorer
+	}
+
+	results := col.results()
+	rank(results, scorer)
+	return results, nil
+}
@@ -0,0 +1,18 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package client
+
+import (
+	"errors"
+)
+
+// ErrUnexpectedResponse is returned when a direct query is answered with a response
+// for a different provider or different params than were queried
+var ErrUnexpectedResponse = errors.New("response does not match query")
+
+// ErrUnknownProtocol is returned when a provider negotiates a protocol that does not belong to any supported version
+var ErrUnknownProtocol = errors.New("unknown protocol")
+
+// ErrNoContentRouting is returned when looking up providers without content routing set
+var ErrNoContentRouting = errors.New("content routing not set")
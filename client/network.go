@@ -7,18 +7,28 @@ import (
 	"context"
 
 	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
 )
 
 // Network defines the libp2p network interface used by the client
 type Network interface {
-	Start() error
-	Stop() error
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
 
-	// Publish broadcasts a message over pub sub on the default topic
-	Publish(ctx context.Context, msg []byte) error
+	// Publish broadcasts a message over pub sub on the given topic
+	Publish(ctx context.Context, topic core.ProtocolID, msg []byte) error
 	// Returns all the hosts multiaddrs
 	MultiAddrs() []string
 
 	RegisterStreamHandler(id core.ProtocolID, handler network.StreamHandler)
+
+	// PrivKey returns the host's private key, used to sign queries
+	PrivKey() crypto.PrivKey
+
+	// Connect connects directly to a peer
+	Connect(ctx context.Context, p peer.AddrInfo) error
+	// NewStream opens a stream to a peer using the first of the protocols it supports, used for direct queries
+	NewStream(ctx context.Context, p peer.ID, protocols ...core.ProtocolID) (network.Stream, error)
 }
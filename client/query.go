@@ -0,0 +1,280 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package client
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// QueryOptions configures how Client.Query collects responses
+type QueryOptions struct {
+	// Timeout bounds how long responses are collected for. If zero, responses are collected
+	// until the context is done or MinResponses is reached.
+	Timeout time.Duration
+	// MinResponses stops collection once this many distinct providers have responded that they have the
+	// data, or will have it later. Unavailable responses to direct queries don't count towards it. If zero,
+	// responses are collected until the timeout or the context is done.
+	MinResponses int
+	// Scorer ranks the collected responses. If nil, PriceScorer is used.
+	Scorer Scorer
+	// Constraints are sent with the query so providers whose terms do not satisfy them do not respond.
+	// Responses that do not satisfy them are also dropped by the client.
+	Constraints *shared.Constraints
+	// MaxProviders bounds the number of providers found through content routing by QueryProviders.
+	// If zero, every provider found before the timeout is queried.
+	MaxProviders int
+}
+
+// Result is a provider's response to a query along with how long it took to arrive
+type Result struct {
+	Response shared.QueryResponse
+	Latency  time.Duration
+}
+
+// Available returns whether the provider has the data, or will have it later, ie. it did not respond with
+// status QueryResponseUnavailable
+func (r *Result) Available() bool {
+	return r.Response.Status != shared.QueryResponseUnavailable
+}
+
+// Scorer returns a score for a result. Results with lower scores are ranked first.
+type Scorer func(r *Result) float64
+
+// PriceScorer ranks results by ascending price per byte
+func PriceScorer(r *Result) float64 {
+	if r.Response.PricePerByte.Int == nil {
+		return 0
+	}
+
+	f, _ := new(big.Float).SetInt(r.Response.PricePerByte.Int).Float64()
+	return f
+}
+
+// PaymentIntervalScorer ranks results by descending payment interval, ie. results
+// that allow more bytes to be retrieved before payment is required are ranked first
+func PaymentIntervalScorer(r *Result) float64 {
+	return -float64(r.Response.PaymentInterval)
+}
+
+// LatencyScorer ranks results by ascending response latency
+func LatencyScorer(r *Result) float64 {
+	return r.Latency.Seconds()
+}
+
+// WeightedScorer is a Scorer with a weight, for use with CombineScorers
+type WeightedScorer struct {
+	Scorer Scorer
+	Weight float64
+}
+
+// CombineScorers returns a Scorer that sums the weighted scores of the given scorers
+func CombineScorers(scorers ...WeightedScorer) Scorer {
+	return func(r *Result) float64 {
+		var score float64
+		for _, s := range scorers {
+			score += s.Weight * s.Scorer(r)
+		}
+		return score
+	}
+}
+
+// Query submits a query for the given params to the network and collects responses until the
+// options' timeout, the context is done, or the minimum number of responses is reached.
+// Responses are deduplicated by provider, keeping the first one received, and returned ranked
+// by the options' scorer. Responses with status QueryResponseAvailable are always ranked
+// before responses with any other status.
+func (c *Client) Query(ctx context.Context, params shared.Params, opts QueryOptions) ([]Result, error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	id := shared.NewQueryID()
+	col := newCollector(opts.MinResponses, opts.Constraints)
+	unsubscribe := c.SubscribeToQueryResponses(col.handleResponse, id)
+	defer unsubscribe()
+
+	err := c.SubmitQueryWithConstraints(ctx, id, params, opts.Constraints)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-col.done:
+	}
+
+	scorer := opts.Scorer
+	if scorer == nil {
+		scorer = PriceScorer
+	}
+
+	results := col.results()
+	rank(results, scorer)
+	return results, nil
+}
+
+// QueryStream submits a query like Query, but sends results on the returned channel in the order they are
+// received rather than ranking them. The options' scorer is unused. The channel is closed once collection ends.
+func (c *Client) QueryStream(ctx context.Context, params shared.Params, opts QueryOptions) (<-chan Result, error) {
+	var cancel context.CancelFunc = func() {}
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+
+	id := shared.NewQueryID()
+	col := newCollector(opts.MinResponses, opts.Constraints)
+	unsubscribe := c.SubscribeToQueryResponses(col.handleResponse, id)
+
+	err := c.SubmitQueryWithConstraints(ctx, id, params, opts.Constraints)
+	if err != nil {
+		unsubscribe()
+		cancel()
+		return nil, err
+	}
+
+	out := make(chan Result)
+	go func() {
+		defer close(out)
+		defer cancel()
+		defer unsubscribe()
+
+		sent := 0
+		send := func() bool {
+			for _, res := range col.resultsFrom(sent) {
+				select {
+				case out <- res:
+					sent++
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+
+		for {
+			select {
+			case <-col.updated:
+				if !send() {
+					return
+				}
+			case <-col.done:
+				send()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// rank sorts results by availability and then by score, preserving arrival order for equal scores
+func rank(results []Result, scorer Scorer) {
+	sort.SliceStable(results, func(i, j int) bool {
+		ai := results[i].Response.Status == shared.QueryResponseAvailable
+		aj := results[j].Response.Status == shared.QueryResponseAvailable
+		if ai != aj {
+			return ai
+		}
+
+		return scorer(&results[i]) < scorer(&results[j])
+	})
+}
+
+// collector gathers the first response from each provider to a single query
+type collector struct {
+	start        time.Time
+	minResponses int
+	constraints  *shared.Constraints
+	lock         sync.Mutex
+	seen         map[peer.ID]struct{}
+	collected    []Result
+	available    int
+	done         chan struct{}
+	updated      chan struct{}
+}
+
+func newCollector(minResponses int, constraints *shared.Constraints) *collector {
+	return &collector{
+		start:        time.Now(),
+		minResponses: minResponses,
+		constraints:  constraints,
+		seen:         make(map[peer.ID]struct{}),
+		done:         make(chan struct{}),
+		updated:      make(chan struct{}, 1),
+	}
+}
+
+// handleResponse is a ClientSubscriber that records the response if it is the first from its provider
+// and satisfies the query's constraints
+func (c *collector) handleResponse(resp shared.QueryResponse) {
+	if !c.constraints.Accepts(&resp) {
+		log.Debug("dropping response from provider ", resp.Provider, " that does not satisfy constraints")
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// responses that arrive once MinResponses is reached are dropped
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	if _, has := c.seen[resp.Provider]; has {
+		return
+	}
+	c.seen[resp.Provider] = struct{}{}
+
+	res := Result{
+		Response: resp,
+		Latency:  time.Since(c.start),
+	}
+	c.collected = append(c.collected, res)
+
+	select {
+	case c.updated <- struct{}{}:
+	default:
+	}
+
+	if !res.Available() {
+		return
+	}
+
+	c.available++
+	if c.available == c.minResponses {
+		close(c.done)
+	}
+}
+
+// results returns a copy of the collected results
+func (c *collector) results() []Result {
+	return c.resultsFrom(0)
+}
+
+// resultsFrom returns a copy of the results collected after the first n
+func (c *collector) resultsFrom(n int) []Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if n >= len(c.collected) {
+		return nil
+	}
+
+	results := make([]Result, len(c.collected)-n)
+	copy(results, c.collected[n:])
+	return results
+}
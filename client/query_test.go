@@ -0,0 +1,184 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func newSignedResponse(t *testing.T, key crypto.PrivKey, query shared.Query, status shared.QueryResponseStatus, price int64, interval uint64) shared.QueryResponse {
+	resp := shared.QueryResponse{
+		ID:              query.ID,
+		Params:          query.Params,
+		Status:          status,
+		Provider:        mustIDFromKey(key),
+		PricePerByte:    abi.NewTokenAmount(price),
+		PaymentInterval: interval,
+	}
+	err := resp.Sign(key)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestClient_Query(t *testing.T) {
+	keyA, keyB, keyC := mustGenerateKey(), mustGenerateKey(), mustGenerateKey()
+
+	var expensive, cheap, later shared.QueryResponse
+	host := &mockNetwork{queries: []shared.Query{}}
+	client := NewClient(host)
+
+	respond := func(responses ...shared.QueryResponse) {
+		for _, resp := range responses {
+			client.handleResponse(resp)
+		}
+	}
+
+	// wait for the minimum number of responses, duplicates from the same provider are ignored
+	host.onPublish = func(query shared.Query) {
+		expensive = newSignedResponse(t, keyA, query, shared.QueryResponseAvailable, 10, 100)
+		cheap = newSignedResponse(t, keyB, query, shared.QueryResponseAvailable, 5, 10)
+		later = newSignedResponse(t, keyC, query, shared.QueryResponseAvailableLater, 1, 10)
+		respond(expensive, expensive, later, cheap)
+	}
+
+	results, err := client.Query(context.Background(), testParams, QueryOptions{MinResponses: 3})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.Equal(t, cheap, results[0].Response)
+	require.Equal(t, expensive, results[1].Response)
+	require.Equal(t, later, results[2].Response)
+
+	// rank by payment interval
+	results, err = client.Query(context.Background(), testParams, QueryOptions{
+		MinResponses: 3,
+		Scorer:       PaymentIntervalScorer,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.Equal(t, expensive, results[0].Response)
+	require.Equal(t, cheap, results[1].Response)
+	require.Equal(t, later, results[2].Response)
+
+	// fewer responses than the minimum return at the timeout
+	host.onPublish = func(query shared.Query) {
+		cheap = newSignedResponse(t, keyB, query, shared.QueryResponseAvailable, 5, 10)
+		respond(cheap)
+	}
+
+	start := time.Now()
+	results, err = client.Query(context.Background(), testParams, QueryOptions{
+		MinResponses: 2,
+		Timeout:      100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(100*time.Millisecond))
+	require.Len(t, results, 1)
+	require.Equal(t, cheap, results[0].Response)
+
+	// responses that don't satisfy the constraints are dropped
+	host.onPublish = func(query shared.Query) {
+		require.NotNil(t, query.Constraints)
+		expensive = newSignedResponse(t, keyA, query, shared.QueryResponseAvailable, 10, 100)
+		cheap = newSignedResponse(t, keyB, query, shared.QueryResponseAvailable, 5, 10)
+		respond(expensive, cheap)
+	}
+
+	maxPrice := abi.NewTokenAmount(5)
+	results, err = client.Query(context.Background(), testParams, QueryOptions{
+		MinResponses: 1,
+		Constraints:  &shared.Constraints{MaxPricePerByte: &maxPrice},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, cheap, results[0].Response)
+}
+
+func TestCollector_MinResponses(t *testing.T) {
+	col := newCollector(2, nil)
+
+	for i := 0; i < 3; i++ {
+		col.handleResponse(shared.QueryResponse{
+			Provider:     peer.ID(fmt.Sprintf("provider-%d", i)),
+			PricePerByte: abi.NewTokenAmount(int64(i)),
+		})
+	}
+
+	// the collector is done after the second response, so the third isn't collected
+	<-col.done
+	results := col.results()
+	require.Len(t, results, 2)
+	require.Equal(t, peer.ID("provider-1"), results[1].Response.Provider)
+}
+
+func TestCollector_MinResponses_Unavailable(t *testing.T) {
+	col := newCollector(1, nil)
+
+	// unavailable responses are collected, but don't count towards the minimum
+	col.handleResponse(shared.QueryResponse{Provider: "unavailable", Status: shared.QueryResponseUnavailable})
+	select {
+	case <-col.done:
+		t.Fatal("collector done after an unavailable response")
+	default:
+	}
+
+	col.handleResponse(shared.QueryResponse{Provider: "later", Status: shared.QueryResponseAvailableLater})
+	<-col.done
+	require.Len(t, col.results(), 2)
+}
+
+func TestCombineScorers(t *testing.T) {
+	fast := &Result{
+		Response: shared.QueryResponse{PricePerByte: abi.NewTokenAmount(10)},
+		Latency:  time.Second,
+	}
+	slow := &Result{
+		Response: shared.QueryResponse{PricePerByte: abi.NewTokenAmount(5)},
+		Latency:  10 * time.Second,
+	}
+
+	scorer := CombineScorers(
+		WeightedScorer{Scorer: PriceScorer, Weight: 1},
+		WeightedScorer{Scorer: LatencyScorer, Weight: 1},
+	)
+	require.Equal(t, float64(11), scorer(fast))
+	require.Equal(t, float64(15), scorer(slow))
+
+	require.Less(t, PriceScorer(slow), PriceScorer(fast))
+	require.Less(t, LatencyScorer(fast), LatencyScorer(slow))
+}
+
+func TestClient_QueryStream(t *testing.T) {
+	keyA, keyB := mustGenerateKey(), mustGenerateKey()
+
+	host := &mockNetwork{queries: []shared.Query{}}
+	client := NewClient(host)
+
+	var expensive, cheap shared.QueryResponse
+	host.onPublish = func(query shared.Query) {
+		expensive = newSignedResponse(t, keyA, query, shared.QueryResponseAvailable, 10, 100)
+		cheap = newSignedResponse(t, keyB, query, shared.QueryResponseAvailable, 5, 10)
+		client.handleResponse(expensive)
+		client.handleResponse(expensive)
+		client.handleResponse(cheap)
+	}
+
+	results, err := client.QueryStream(context.Background(), testParams, QueryOptions{Timeout: time.Second})
+	require.NoError(t, err)
+
+	// results are streamed in the order they are received, until the timeout
+	var received []shared.QueryResponse
+	for res := range results {
+		received = append(received, res.Response)
+	}
+	require.Equal(t, []shared.QueryResponse{expensive, cheap}, received)
+}
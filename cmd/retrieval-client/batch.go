@@ -0,0 +1,318 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/client"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/cmd/utils"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/urfave/cli"
+)
+
+var (
+	inputFlag = cli.StringFlag{
+		Name:  "input",
+		Usage: "file to read CIDs from, or - for stdin",
+		Value: "-",
+	}
+
+	concurrencyFlag = cli.IntFlag{
+		Name:  "concurrency",
+		Usage: "number of queries to run at once",
+		Value: 8,
+	}
+
+	batchTimeoutFlag = cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "time to collect responses for each query",
+		Value: 10 * time.Second,
+	}
+
+	batchCommand = cli.Command{
+		Name:  "batch",
+		Usage: "Query every CID in a file and report which providers offered them",
+		Description: `The input has one payload CID per line, optionally followed by a piece CID separated by
+   a space or comma. Blank lines and lines starting with # are ignored.
+   The report lists the responses to each query in the order of the input, ranked by price.`,
+		Flags:  []cli.Flag{inputFlag, concurrencyFlag, batchTimeoutFlag, minResponsesFlag, outputFlag},
+		Action: runBatch,
+	}
+)
+
+// batchEntry is the report for a single query of a batch
+type batchEntry struct {
+	PayloadCID string        `json:"payloadCID"`
+	PieceCID   string        `json:"pieceCID,omitempty"`
+	Responses  []*resultJSON `json:"responses"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// readBatchInput returns the params of each query in the input
+func readBatchInput(r io.Reader) ([]shared.Params, error) {
+	var params []shared.Params
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected a payload cid and an optional piece cid", line)
+		}
+
+		payloadCID, err := cid.Decode(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid payload cid: %w", line, err)
+		}
+
+		p := shared.Params{
+			PayloadCID: payloadCID,
+		}
+
+		if len(fields) == 2 {
+			pieceCID, err := cid.Decode(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid piece cid: %w", line, err)
+			}
+			p.PieceCID = &pieceCID
+		}
+
+		params = append(params, p)
+	}
+
+	return params, scanner.Err()
+}
+
+// queryBatch queries each of the params with at most concurrency queries at once.
+// The entries are returned in the order of the params.
+func queryBatch(ctx context.Context, c *client.Client, params []shared.Params, concurrency int, opts client.QueryOptions, addrs func(peer.ID) []string) []*batchEntry {
+	entries := make([]*batchEntry, len(params))
+	indices := make(chan int)
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				entries[i] = queryBatchEntry(ctx, c, params[i], opts, addrs)
+			}
+		}()
+	}
+
+	for i := range params {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return entries
+}
+
+func queryBatchEntry(ctx context.Context, c *client.Client, params shared.Params, opts client.QueryOptions, addrs func(peer.ID) []string) *batchEntry {
+	entry := &batchEntry{
+		PayloadCID: params.PayloadCID.String(),
+		Responses:  []*resultJSON{},
+	}
+
+	if params.PieceCID != nil {
+		entry.PieceCID = params.PieceCID.String()
+	}
+
+	results, err := c.Query(ctx, params, opts)
+	if err != nil {
+		log.Error("failed to query ", entry.PayloadCID, "; error: ", err)
+		entry.Error = err.Error()
+		return entry
+	}
+
+	for _, res := range results {
+		entry.Responses = append(entry.Responses, newResultJSON(res, addrs))
+	}
+
+	log.Debug("got ", len(results), " responses for ", entry.PayloadCID)
+	return entry
+}
+
+// writeReport writes the batch report to w in the given output format
+func writeReport(w io.Writer, format string, entries []*batchEntry) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case outputNDJSON:
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			err := enc.Encode(e)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, err := fmt.Fprintln(tw, "PAYLOAD\tPIECE\tPROVIDER\tSTATUS\tPRICE/BYTE\tINTERVAL\tINCREASE\tLATENCY")
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			piece := e.PieceCID
+			if piece == "" {
+				piece = "-"
+			}
+
+			if len(e.Responses) == 0 {
+				status := "no responses"
+				if e.Error != "" {
+					status = "error: " + e.Error
+				}
+
+				_, err = fmt.Fprintf(tw, "%s\t%s\t-\t%s\t-\t-\t-\t-\n", e.PayloadCID, piece, status)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			for _, r := range e.Responses {
+				_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
+					e.PayloadCID,
+					piece,
+					r.Provider,
+					r.Status,
+					r.PricePerByte,
+					r.PaymentInterval,
+					r.PaymentIntervalIncrease,
+					time.Duration(r.LatencyMs)*time.Millisecond,
+				)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q, must be one of %s", format, strings.Join(outputFormats, ", "))
+	}
+}
+
+func runBatch(ctx *cli.Context) error {
+	err := setLogLevels()
+	if err != nil {
+		return err
+	}
+
+	output := ctx.String(outputFlag.Name)
+
+	// fail early on an unknown output format, rather than after querying
+	err = writeReport(ioutil.Discard, output, nil)
+	if err != nil {
+		return err
+	}
+
+	bootnodesStr, err := bootnodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if path := ctx.String(inputFlag.Name); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		in = f
+	}
+
+	params, err := readBatchInput(in)
+	if err != nil {
+		return err
+	}
+
+	if len(params) == 0 {
+		return fmt.Errorf("no cids to query")
+	}
+
+	hostOpts, err := utils.HostOptionsFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	n, err := utils.NewNetwork(bootnodesStr, hostOpts)
+	if err != nil {
+		return fmt.Errorf("failed to create network: %s", err)
+	}
+
+	c := client.NewClient(n)
+	// stop querying on SIGINT or SIGTERM, and report the responses already received
+	runCtx, cancel := utils.ShutdownContext()
+	defer cancel()
+
+	err = c.Start(runCtx)
+	if err != nil {
+		return err
+	}
+
+	defer stopClient(c)
+
+	log.Info("Querying for ", len(params), " cids")
+
+	time.Sleep(time.Second)
+	entries := queryBatch(runCtx, c, params, ctx.Int(concurrencyFlag.Name), client.QueryOptions{
+		Timeout:      ctx.Duration(batchTimeoutFlag.Name),
+		MinResponses: ctx.Int(minResponsesFlag.Name),
+		Scorer:       client.PriceScorer,
+	}, n.PeerAddrs)
+
+	err = writeReport(os.Stdout, output, entries)
+	if err != nil {
+		return err
+	}
+
+	available := 0
+	for _, e := range entries {
+		if len(e.Responses) > 0 {
+			available++
+		}
+	}
+
+	log.Info("got responses for ", available, " of ", len(entries), " cids")
+
+	if available == 0 {
+		return cli.NewExitError("no responses received by timeout", exitNoResponses)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPieceCidStr = "bafk2bzacecbimgaxdtxo6sbyzqakaupadbzomlbuxqjvfoat6cwbfvmsvdvym"
+
+func TestReadBatchInput(t *testing.T) {
+	input := strings.Join([]string{
+		"# payload cids",
+		testCidStr,
+		"",
+		"  " + testCidStr + " " + testPieceCidStr,
+		testCidStr + "," + testPieceCidStr,
+	}, "\n")
+
+	params, err := readBatchInput(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, params, 3)
+	require.Equal(t, testCidStr, params[0].PayloadCID.String())
+	require.Nil(t, params[0].PieceCID)
+	for _, p := range params[1:] {
+		require.Equal(t, testCidStr, p.PayloadCID.String())
+		require.Equal(t, testPieceCidStr, p.PieceCID.String())
+	}
+
+	for _, input := range []string{
+		"not a cid",
+		testCidStr + " not a cid",
+		testCidStr + " " + testPieceCidStr + " " + testCidStr,
+	} {
+		_, err = readBatchInput(strings.NewReader(input))
+		require.Error(t, err)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	results := testResults(t)
+	entries := []*batchEntry{
+		{
+			PayloadCID: testCidStr,
+			Responses: []*resultJSON{
+				newResultJSON(results[0], testAddrs),
+				newResultJSON(results[1], testAddrs),
+			},
+		},
+		{
+			PayloadCID: testCidStr,
+			PieceCID:   testPieceCidStr,
+			Responses:  []*resultJSON{},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	err := writeReport(buf, outputJSON, entries)
+	require.NoError(t, err)
+
+	var report []*batchEntry
+	err = json.Unmarshal(buf.Bytes(), &report)
+	require.NoError(t, err)
+	require.Equal(t, entries, report)
+
+	buf.Reset()
+	err = writeReport(buf, outputNDJSON, entries)
+	require.NoError(t, err)
+	require.Len(t, strings.Split(strings.TrimSpace(buf.String()), "\n"), 2)
+
+	// one row per response, and one for each cid without responses
+	buf.Reset()
+	err = writeReport(buf, outputTable, entries)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+	require.Contains(t, lines[1], results[0].Response.Provider.String())
+	require.Contains(t, lines[2], results[1].Response.Provider.String())
+	require.Contains(t, lines[3], testPieceCidStr)
+	require.Contains(t, lines[3], "no responses")
+
+	err = writeReport(buf, "xml", entries)
+	require.Error(t, err)
+}
@@ -0,0 +1,223 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/client"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/cmd/utils"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/urfave/cli"
+)
+
+var (
+	listenFlag = cli.StringFlag{
+		Name:  "listen",
+		Usage: "address to serve the HTTP API on",
+		Value: "127.0.0.1:8765",
+	}
+
+	queryTimeoutFlag = cli.DurationFlag{
+		Name:  "query-timeout",
+		Usage: "default and maximum time to collect responses for each query",
+		Value: 30 * time.Second,
+	}
+
+	daemonCommand = cli.Command{
+		Name:  "daemon",
+		Usage: "Stay connected to the network and serve queries over a local HTTP API",
+		Description: `Queries are submitted with POST /query and a JSON body such as
+   {"payloadCID": "<CID>", "pieceCID": "<CID>", "timeout": 10, "minResponses": 1, "maxPricePerByte": "2"}
+   where every field except payloadCID is optional and timeout is in seconds.
+   Responses are streamed back as newline-delimited JSON as soon as they are received.`,
+		Flags:  []cli.Flag{listenFlag, queryTimeoutFlag},
+		Action: runDaemon,
+	}
+)
+
+// queryRequest is the body of a POST /query request
+type queryRequest struct {
+	PayloadCID                 string `json:"payloadCID"`
+	PieceCID                   string `json:"pieceCID,omitempty"`
+	Timeout                    int64  `json:"timeout,omitempty"` // Seconds to collect responses for
+	MinResponses               int    `json:"minResponses,omitempty"`
+	MaxPricePerByte            string `json:"maxPricePerByte,omitempty"`
+	MinPaymentInterval         uint64 `json:"minPaymentInterval,omitempty"`
+	MaxPaymentIntervalIncrease uint64 `json:"maxPaymentIntervalIncrease,omitempty"`
+}
+
+// params returns the query params and options of the request
+func (r *queryRequest) params(maxTimeout time.Duration) (shared.Params, client.QueryOptions, error) {
+	payloadCID, err := cid.Decode(r.PayloadCID)
+	if err != nil {
+		return shared.Params{}, client.QueryOptions{}, fmt.Errorf("invalid payload cid: %w", err)
+	}
+
+	params := shared.Params{
+		PayloadCID: payloadCID,
+	}
+
+	if r.PieceCID != "" {
+		pieceCID, err := cid.Decode(r.PieceCID)
+		if err != nil {
+			return shared.Params{}, client.QueryOptions{}, fmt.Errorf("invalid piece cid: %w", err)
+		}
+		params.PieceCID = &pieceCID
+	}
+
+	opts := client.QueryOptions{
+		Timeout:      maxTimeout,
+		MinResponses: r.MinResponses,
+	}
+
+	if timeout := time.Duration(r.Timeout) * time.Second; timeout > 0 && timeout < maxTimeout {
+		opts.Timeout = timeout
+	}
+
+	constraints := &shared.Constraints{
+		MinPaymentInterval:         r.MinPaymentInterval,
+		MaxPaymentIntervalIncrease: r.MaxPaymentIntervalIncrease,
+	}
+
+	if r.MaxPricePerByte != "" {
+		maxPrice, err := big.FromString(r.MaxPricePerByte)
+		if err != nil {
+			return shared.Params{}, client.QueryOptions{}, fmt.Errorf("invalid max price: %w", err)
+		}
+		constraints.MaxPricePerByte = &maxPrice
+	}
+
+	if *constraints != (shared.Constraints{}) {
+		opts.Constraints = constraints
+	}
+
+	return params, opts, nil
+}
+
+// queryHandler serves POST /query, streaming each response as a line of JSON
+type queryHandler struct {
+	client     *client.Client
+	addrs      func(peer.ID) []string
+	maxTimeout time.Duration
+}
+
+func (h *queryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := new(queryRequest)
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params, opts, err := req.params(h.maxTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// stop collecting responses if the caller goes away
+	results, err := h.client.QueryStream(r.Context(), params, opts)
+	if err != nil {
+		log.Error("failed to submit query; error: ", err)
+		http.Error(w, "failed to submit query: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	for res := range results {
+		err = enc.Encode(newResultJSON(res, h.addrs))
+		if err != nil {
+			log.Warn("failed to write response; error: ", err)
+			continue
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func runDaemon(ctx *cli.Context) error {
+	err := setLogLevels()
+	if err != nil {
+		return err
+	}
+
+	bootnodesStr, err := bootnodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	hostOpts, err := utils.HostOptionsFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	n, err := utils.NewNetwork(bootnodesStr, hostOpts)
+	if err != nil {
+		return fmt.Errorf("failed to create network: %s", err)
+	}
+
+	c := client.NewClient(n)
+	runCtx, cancel := utils.ShutdownContext()
+	defer cancel()
+
+	err = c.Start(runCtx)
+	if err != nil {
+		return err
+	}
+
+	defer stopClient(c)
+
+	mux := http.NewServeMux()
+	mux.Handle("/query", &queryHandler{
+		client:     c,
+		addrs:      n.PeerAddrs,
+		maxTimeout: ctx.Duration(queryTimeoutFlag.Name),
+	})
+
+	server := &http.Server{
+		Addr:    ctx.String(listenFlag.Name),
+		Handler: mux,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	log.Info("client daemon listening at ", server.Addr, " with peer ID ", n.PeerID())
+
+	select {
+	case err = <-errs:
+		return err
+	case <-runCtx.Done():
+		log.Info("shutting down")
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), ctx.Duration(queryTimeoutFlag.Name))
+	defer cancelShutdown()
+	return server.Shutdown(shutdownCtx)
+}
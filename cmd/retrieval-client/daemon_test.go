@@ -0,0 +1,70 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/stretchr/testify/require"
+)
+
+const testCidStr = "bafybeierhgbz4zp2x2u67urqrgfnrnlukciupzenpqpipiz5nwtq7uxpx4"
+
+func TestQueryRequest_Params(t *testing.T) {
+	req := &queryRequest{
+		PayloadCID:         testCidStr,
+		PieceCID:           testCidStr,
+		Timeout:            5,
+		MinResponses:       2,
+		MaxPricePerByte:    "3",
+		MinPaymentInterval: 10,
+	}
+
+	params, opts, err := req.params(time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, testCidStr, params.PayloadCID.String())
+	require.Equal(t, testCidStr, params.PieceCID.String())
+	require.Equal(t, 5*time.Second, opts.Timeout)
+	require.Equal(t, 2, opts.MinResponses)
+	require.Equal(t, abi.NewTokenAmount(3), *opts.Constraints.MaxPricePerByte)
+	require.Equal(t, uint64(10), opts.Constraints.MinPaymentInterval)
+
+	// the timeout is capped and constraints are omitted if unset
+	req = &queryRequest{PayloadCID: testCidStr, Timeout: 120}
+	params, opts, err = req.params(time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, params.PieceCID)
+	require.Equal(t, time.Minute, opts.Timeout)
+	require.Nil(t, opts.Constraints)
+
+	for _, req := range []*queryRequest{
+		{PayloadCID: "not a cid"},
+		{PayloadCID: testCidStr, PieceCID: "not a cid"},
+		{PayloadCID: testCidStr, MaxPricePerByte: "not a number"},
+	} {
+		_, _, err = req.params(time.Minute)
+		require.Error(t, err)
+	}
+}
+
+func TestQueryHandler_BadRequest(t *testing.T) {
+	h := &queryHandler{maxTimeout: time.Minute}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/query", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/query", strings.NewReader("{")))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"payloadCID": "not a cid"}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
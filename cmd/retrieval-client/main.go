@@ -4,16 +4,20 @@
 package main
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/client"
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/cmd/utils"
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
 	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
 	"github.com/urfave/cli"
 )
 
@@ -21,9 +25,13 @@ var (
 	log = logging.Logger("client-main")
 
 	bootnodesFlag = cli.StringFlag{
-		Name:     "bootnodes",
-		Usage:    "comma-separated list of peer addresses",
-		Required: true,
+		Name:  "bootnodes",
+		Usage: "comma-separated list of peer addresses, required to query",
+	}
+
+	dhtFlag = cli.BoolFlag{
+		Name:  "dht",
+		Usage: "find providers on the Kademlia DHT and query them directly, rather than gossiping the query",
 	}
 
 	pieceCIDFlag = cli.StringFlag{
@@ -37,10 +45,57 @@ var (
 		Value: defaultResponseTimeout,
 	}
 
+	minResponsesFlag = cli.IntFlag{
+		Name:  "min-responses",
+		Usage: "stop listening once this many providers have responded (0 waits until the timeout)",
+	}
+
+	rankFlag = cli.StringFlag{
+		Name:  "rank",
+		Usage: "rank responses by price, interval or latency",
+		Value: "price",
+	}
+
+	maxPriceFlag = cli.StringFlag{
+		Name:  "max-price",
+		Usage: "maximum acceptable price per byte",
+	}
+
+	minPaymentIntervalFlag = cli.Uint64Flag{
+		Name:  "min-payment-interval",
+		Usage: "minimum acceptable payment interval (bytes)",
+	}
+
+	maxPaymentIntervalIncreaseFlag = cli.Uint64Flag{
+		Name:  "max-payment-interval-increase",
+		Usage: "maximum acceptable payment interval increase (bytes), 0 for no limit",
+	}
+
+	outputFlag = cli.StringFlag{
+		Name:  "output",
+		Usage: "output format of the responses: " + strings.Join(outputFormats, ", "),
+		Value: outputTable,
+	}
+
 	flags = []cli.Flag{
 		bootnodesFlag,
+		dhtFlag,
+		utils.IdentityFlag,
+		utils.ListenAddrsFlag,
+		outputFlag,
 		pieceCIDFlag,
 		timeoutFlag,
+		minResponsesFlag,
+		rankFlag,
+		maxPriceFlag,
+		minPaymentIntervalFlag,
+		maxPaymentIntervalIncreaseFlag,
+	}
+
+	scorers = map[string]client.Scorer{
+		"price":    client.PriceScorer,
+		"interval": client.PaymentIntervalScorer,
+		"latency":  client.LatencyScorer,
 	}
 
 	app = cli.NewApp()
@@ -48,10 +103,17 @@ var (
 	defaultResponseTimeout = int64(time.Minute.Seconds())
 )
 
+// errNoBootnodes is returned by the commands that query the network when --bootnodes is not set
+var errNoBootnodes = errors.New("--bootnodes is required")
+
+// exitNoResponses is the exit code when no provider responds before the timeout
+const exitNoResponses = 2
+
 func init() {
 	app.Action = run
 	app.Name = "retrieval-client"
 	app.Flags = flags
+	app.Commands = []cli.Command{batchCommand, daemonCommand, utils.KeygenCommand}
 	app.Usage = "Client for secondary retrieval markets"
 	app.UsageText = "retrieval-client [options] <CID>"
 }
@@ -63,56 +125,84 @@ func main() {
 	}
 }
 
-func run(ctx *cli.Context) error {
+func setLogLevels() error {
 	err := logging.SetLogLevel("client", "debug")
 	if err != nil {
 		return err
 	}
-	err = logging.SetLogLevel("client-main", "debug")
+	return logging.SetLogLevel("client-main", "debug")
+}
+
+func run(ctx *cli.Context) error {
+	err := setLogLevels()
 	if err != nil {
 		return err
 	}
 
 	cidStr := ctx.Args().First()
 	pieceCIDStr := ctx.String(pieceCIDFlag.Name)
-	bootnodesStr := ctx.String(bootnodesFlag.Name)
 	timeout := ctx.Int64(timeoutFlag.Name)
+	output := ctx.String(outputFlag.Name)
 
-	n, err := utils.NewNetwork(bootnodesStr)
+	// fail early on an unknown output format, rather than after querying
+	err = writeResults(ioutil.Discard, output, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	bootnodesStr, err := bootnodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	scorer, ok := scorers[ctx.String(rankFlag.Name)]
+	if !ok {
+		return fmt.Errorf("unknown rank %q", ctx.String(rankFlag.Name))
+	}
+
+	constraints, err := parseConstraints(ctx)
+	if err != nil {
+		return err
+	}
+
+	hostOpts, err := utils.HostOptionsFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	n, err := utils.NewNetwork(bootnodesStr, hostOpts)
 	if err != nil {
 		return fmt.Errorf("failed to create network: %s", err)
 	}
 
 	c := client.NewClient(n)
-	var payloadCID, pieceCID cid.Cid
-	payloadCID, err = cid.Decode(cidStr)
+	payloadCID, err := cid.Decode(cidStr)
 	if err != nil {
 		return fmt.Errorf("failed to decode query cid: %s", err)
 	}
 
+	params := shared.Params{
+		PayloadCID: payloadCID,
+	}
+
 	if pieceCIDStr != "" {
-		pieceCID, err = cid.Decode(pieceCIDStr)
+		pieceCID, err := cid.Decode(pieceCIDStr)
 		if err != nil {
 			return err
 		}
+		params.PieceCID = &pieceCID
 	}
 
-	err = c.Start()
+	// stop collecting responses on SIGINT or SIGTERM, and write those already received
+	runCtx, cancel := utils.ShutdownContext()
+	defer cancel()
+
+	err = c.Start(runCtx)
 	if err != nil {
 		return err
 	}
 
-	defer func() {
-		err = c.Stop()
-		if err != nil {
-			log.Error("failed to stop client", err)
-		}
-	}()
-
-	params := shared.Params{
-		PayloadCID: payloadCID,
-		PieceCID:   &pieceCID,
-	}
+	defer stopClient(c)
 
 	if pieceCIDStr != "" {
 		log.Infof("Querying for payload %s and piece %s", payloadCID, pieceCIDStr)
@@ -120,22 +210,98 @@ func run(ctx *cli.Context) error {
 		log.Infof("Querying for payload %s", payloadCID)
 	}
 
-	h := newResponseHandler()
-	unsubscribe := c.SubscribeToQueryResponses(h.handleResponse, params)
-	defer unsubscribe()
+	opts := client.QueryOptions{
+		Timeout:      time.Duration(timeout) * time.Second,
+		MinResponses: ctx.Int(minResponsesFlag.Name),
+		Scorer:       scorer,
+		Constraints:  constraints,
+	}
+
+	var results []client.Result
+	if ctx.Bool(dhtFlag.Name) {
+		d, err := utils.NewDHT(runCtx, n, dht.ModeClient)
+		if err != nil {
+			return fmt.Errorf("failed to start DHT: %w", err)
+		}
+
+		defer func() {
+			_ = d.Close()
+		}()
 
-	time.Sleep(time.Second)
-	err = c.SubmitQuery(context.Background(), params)
+		c.SetContentRouting(d)
+		results, err = c.QueryProviders(runCtx, params, opts)
+		if err != nil {
+			return err
+		}
+	} else {
+		time.Sleep(time.Second)
+		results, err = c.Query(runCtx, params, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writeResults(os.Stdout, output, results, n.PeerAddrs)
 	if err != nil {
 		return err
 	}
-	for {
-		select {
-		case resp := <-h.respCh:
-			log.Info("got response from provider ", resp)
-		case <-time.After(time.Duration(time.Second.Nanoseconds() * timeout)):
-			log.Info("no responses received by timeout")
-			return nil
+
+	// providers found through content routing respond even if they no longer have the data
+	if !anyAvailable(results) {
+		return cli.NewExitError("no responses received by timeout", exitNoResponses)
+	}
+
+	return nil
+}
+
+// anyAvailable returns whether any of the results is from a provider that has, or will have, the data
+func anyAvailable(results []client.Result) bool {
+	for i := range results {
+		if results[i].Available() {
+			return true
+		}
+	}
+	return false
+}
+
+// bootnodes returns the value of the global --bootnodes flag, which must be set
+func bootnodes(ctx *cli.Context) (string, error) {
+	s := ctx.GlobalString(bootnodesFlag.Name)
+	if strings.TrimSpace(s) == "" {
+		return "", errNoBootnodes
+	}
+	return s, nil
+}
+
+// stopClient stops the client, logging any error
+func stopClient(c *client.Client) {
+	ctx, cancel := utils.StopContext()
+	defer cancel()
+
+	err := c.Stop(ctx)
+	if err != nil {
+		log.Error("failed to stop client; error: ", err)
+	}
+}
+
+// parseConstraints returns the constraints set by flags, or nil if none are set
+func parseConstraints(ctx *cli.Context) (*shared.Constraints, error) {
+	constraints := &shared.Constraints{
+		MinPaymentInterval:         ctx.Uint64(minPaymentIntervalFlag.Name),
+		MaxPaymentIntervalIncrease: ctx.Uint64(maxPaymentIntervalIncreaseFlag.Name),
+	}
+
+	if maxPriceStr := ctx.String(maxPriceFlag.Name); maxPriceStr != "" {
+		maxPrice, err := big.FromString(maxPriceStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max price: %w", err)
 		}
+		constraints.MaxPricePerByte = &maxPrice
 	}
+
+	if *constraints == (shared.Constraints{}) {
+		return nil, nil
+	}
+
+	return constraints, nil
 }
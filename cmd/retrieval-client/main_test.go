@@ -0,0 +1,41 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func TestBootnodes(t *testing.T) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	bootnodesFlag.Apply(set)
+
+	_, err := bootnodes(cli.NewContext(app, set, nil))
+	require.Equal(t, errNoBootnodes, err)
+
+	require.NoError(t, set.Parse([]string{"--bootnodes", "/ip4/127.0.0.1/tcp/4001"}))
+	s, err := bootnodes(cli.NewContext(app, set, nil))
+	require.NoError(t, err)
+	require.Equal(t, "/ip4/127.0.0.1/tcp/4001", s)
+}
+
+func TestKeygen_NoBootnodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keygen")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	// commands that don't query the network don't need bootnodes
+	err = app.Run([]string{"retrieval-client", "keygen", filepath.Join(dir, "client.key")})
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(dir, "client.key"))
+}
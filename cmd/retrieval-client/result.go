@@ -0,0 +1,111 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/client"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// output formats
+const (
+	outputTable  = "table"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+var outputFormats = []string{outputTable, outputJSON, outputNDJSON}
+
+// resultJSON is the JSON representation of a provider's response written by the client
+type resultJSON struct {
+	QueryID                 string   `json:"queryID"`
+	PayloadCID              string   `json:"payloadCID"`
+	PieceCID                string   `json:"pieceCID,omitempty"`
+	Provider                string   `json:"provider"`
+	ProviderAddrs           []string `json:"providerAddrs"`
+	Status                  string   `json:"status"`
+	ETA                     uint64   `json:"eta,omitempty"`
+	PricePerByte            string   `json:"pricePerByte"`
+	PaymentInterval         uint64   `json:"paymentInterval"`
+	PaymentIntervalIncrease uint64   `json:"paymentIntervalIncrease"`
+	LatencyMs               int64    `json:"latencyMs"`
+}
+
+// newResultJSON returns the JSON representation of the result, including the provider's known addrs
+func newResultJSON(res client.Result, addrs func(peer.ID) []string) *resultJSON {
+	resp := res.Response
+	r := &resultJSON{
+		QueryID:                 string(resp.ID),
+		PayloadCID:              resp.Params.PayloadCID.String(),
+		Provider:                resp.Provider.String(),
+		ProviderAddrs:           addrs(resp.Provider),
+		Status:                  resp.Status.String(),
+		ETA:                     resp.ETA,
+		PricePerByte:            resp.PricePerByte.String(),
+		PaymentInterval:         resp.PaymentInterval,
+		PaymentIntervalIncrease: resp.PaymentIntervalIncrease,
+		LatencyMs:               res.Latency.Milliseconds(),
+	}
+
+	if resp.Params.PieceCID != nil {
+		r.PieceCID = resp.Params.PieceCID.String()
+	}
+
+	return r
+}
+
+// writeResults writes the results to w in the given output format
+func writeResults(w io.Writer, format string, results []client.Result, addrs func(peer.ID) []string) error {
+	rs := make([]*resultJSON, len(results))
+	for i, res := range results {
+		rs[i] = newResultJSON(res, addrs)
+	}
+
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rs)
+	case outputNDJSON:
+		enc := json.NewEncoder(w)
+		for _, r := range rs {
+			err := enc.Encode(r)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, err := fmt.Fprintln(tw, "PROVIDER\tSTATUS\tPRICE/BYTE\tINTERVAL\tINCREASE\tLATENCY\tADDRS")
+		if err != nil {
+			return err
+		}
+
+		for _, r := range rs {
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+				r.Provider,
+				r.Status,
+				r.PricePerByte,
+				r.PaymentInterval,
+				r.PaymentIntervalIncrease,
+				time.Duration(r.LatencyMs)*time.Millisecond,
+				strings.Join(r.ProviderAddrs, ","),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q, must be one of %s", format, strings.Join(outputFormats, ", "))
+	}
+}
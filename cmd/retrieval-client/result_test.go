@@ -0,0 +1,101 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/client"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func testResults(t *testing.T) []client.Result {
+	payloadCID, err := cid.Decode(testCidStr)
+	require.NoError(t, err)
+
+	results := []client.Result{}
+	for i, provider := range []peer.ID{"provider-a", "provider-b"} {
+		results = append(results, client.Result{
+			Response: shared.QueryResponse{
+				ID:              "query",
+				Params:          shared.Params{PayloadCID: payloadCID},
+				Status:          shared.QueryResponseAvailable,
+				Provider:        provider,
+				PricePerByte:    abi.NewTokenAmount(int64(i + 1)),
+				PaymentInterval: 100,
+			},
+			Latency: time.Duration(i+1) * time.Second,
+		})
+	}
+	return results
+}
+
+func testAddrs(p peer.ID) []string {
+	return []string{"/ip4/127.0.0.1/tcp/4001/p2p/" + p.String()}
+}
+
+func TestWriteResults(t *testing.T) {
+	results := testResults(t)
+
+	buf := new(bytes.Buffer)
+	err := writeResults(buf, outputJSON, results, testAddrs)
+	require.NoError(t, err)
+
+	var rs []*resultJSON
+	err = json.Unmarshal(buf.Bytes(), &rs)
+	require.NoError(t, err)
+	require.Len(t, rs, 2)
+	require.Equal(t, results[0].Response.Provider.String(), rs[0].Provider)
+	require.Equal(t, testAddrs(results[0].Response.Provider), rs[0].ProviderAddrs)
+	require.Equal(t, "1", rs[0].PricePerByte)
+	require.Equal(t, uint64(100), rs[0].PaymentInterval)
+	require.Equal(t, int64(1000), rs[0].LatencyMs)
+
+	buf.Reset()
+	err = writeResults(buf, outputNDJSON, results, testAddrs)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	for i, line := range lines {
+		r := new(resultJSON)
+		err = json.Unmarshal([]byte(line), r)
+		require.NoError(t, err)
+		require.Equal(t, results[i].Response.Provider.String(), r.Provider)
+	}
+
+	buf.Reset()
+	err = writeResults(buf, outputTable, results, testAddrs)
+	require.NoError(t, err)
+
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	require.True(t, strings.HasPrefix(lines[0], "PROVIDER"))
+	require.Contains(t, lines[1], results[0].Response.Provider.String())
+	require.Contains(t, lines[2], "2s")
+
+	err = writeResults(buf, "xml", results, testAddrs)
+	require.Error(t, err)
+}
+
+func TestWriteResults_Empty(t *testing.T) {
+	// an empty json array is written, rather than null
+	buf := new(bytes.Buffer)
+	err := writeResults(buf, outputJSON, nil, testAddrs)
+	require.NoError(t, err)
+	require.Equal(t, "[]", strings.TrimSpace(buf.String()))
+
+	buf.Reset()
+	err = writeResults(buf, outputNDJSON, nil, testAddrs)
+	require.NoError(t, err)
+	require.Empty(t, buf.String())
+}
@@ -0,0 +1,303 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/cache"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/network"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/provider"
+	"github.com/ipfs/go-cid"
+)
+
+// adminServiceName is the name under which the admin methods are registered, eg. "Admin.Status"
+const adminServiceName = "Admin"
+
+// defaultAdminSocket is the default path of the unix socket the admin API is served on
+var defaultAdminSocket = adminSocketPath()
+
+// adminSocketPath returns the path of the admin socket in a directory private to the current user:
+// $XDG_RUNTIME_DIR/retrieval-provider if set, otherwise the provider's data directory, ~/.retrieval-provider
+func adminSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "retrieval-provider", "admin.sock")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.TempDir()
+	}
+	return filepath.Join(home, ".retrieval-provider", "admin.sock")
+}
+
+// errInventoryReadOnly is returned when modifying the inventory of a store that can't be modified at runtime
+var errInventoryReadOnly = errors.New("store does not support adding or removing cids")
+
+// errInventoryNotReloadable is returned when reloading the inventory of a store that isn't loaded from disk
+var errInventoryNotReloadable = errors.New("store does not support reloading")
+
+// inventory is implemented by stores whose CIDs can be listed and modified at runtime
+type inventory interface {
+	CIDs() []cid.Cid
+	Add(cids ...cid.Cid) error
+	Remove(cids ...cid.Cid) error
+}
+
+// Empty is used for admin methods that take no arguments or return no result
+type Empty struct{}
+
+// StatusResult is the result of Admin.Status
+type StatusResult struct {
+	PeerID           string   `json:"peerID"`
+	Addrs            []string `json:"addrs"`
+	Peers            int      `json:"peers"`
+	CachedCIDs       int      `json:"cachedCIDs"`
+	Inventory        int      `json:"inventory"`        // Number of CIDs in the store, or -1 if the store can't be listed
+	DroppedQueries   uint64   `json:"droppedQueries"`   // Number of gossiped queries dropped because the queue was full
+	ThrottledQueries uint64   `json:"throttledQueries"` // Number of queries dropped by the rate limit
+
+	// Gossip messages received, dropped because the buffer was full, and rejected because they weren't valid queries
+	DeliveredMessages uint64 `json:"deliveredMessages"`
+	DroppedMessages   uint64 `json:"droppedMessages"`
+	RejectedMessages  uint64 `json:"rejectedMessages"`
+}
+
+// Pricing is the argument of Admin.SetPricing and the result of Admin.GetPricing
+type Pricing struct {
+	PricePerByte            string `json:"pricePerByte"`
+	PaymentInterval         uint64 `json:"paymentInterval"`
+	PaymentIntervalIncrease uint64 `json:"paymentIntervalIncrease"`
+}
+
+// CIDsArgs is the argument of the admin methods that take a list of CIDs
+type CIDsArgs struct {
+	CIDs []string `json:"cids"`
+}
+
+// CacheEntry is a CID in the request cache and its record
+type CacheEntry struct {
+	CID    string        `json:"cid"`
+	Record *cache.Record `json:"record"`
+}
+
+// AdminService implements the provider's admin API
+type AdminService struct {
+	provider *provider.Provider
+	net      *network.Network
+	store    provider.RetrievalProviderStore
+	cache    provider.RequestCache
+}
+
+// Status returns the provider's identity, addresses, the sizes of its cache and inventory, and message and query counters
+func (s *AdminService) Status(_ *Empty, res *StatusResult) error {
+	res.PeerID = s.net.PeerID().String()
+	res.Addrs = s.net.MultiAddrs()
+	res.Peers = len(s.net.ConnectedPeers())
+	res.CachedCIDs = len(s.cache.Keys())
+	res.DroppedQueries = s.provider.DroppedQueries()
+	res.ThrottledQueries = s.provider.ThrottledQueries()
+	res.DeliveredMessages = s.net.Delivered()
+	res.DroppedMessages = s.net.Dropped()
+	res.RejectedMessages = s.net.Rejected()
+	res.Inventory = -1
+	if inv, ok := s.store.(inventory); ok {
+		res.Inventory = len(inv.CIDs())
+	} else if cs, ok := s.store.(interface{ Len() int }); ok {
+		res.Inventory = cs.Len()
+	}
+	return nil
+}
+
+// Peers returns the IDs of the peers the provider is connected to
+func (s *AdminService) Peers(_ *Empty, res *[]string) error {
+	for _, p := range s.net.ConnectedPeers() {
+		*res = append(*res, p.String())
+	}
+	return nil
+}
+
+// GetPricing returns the provider's base terms
+func (s *AdminService) GetPricing(_ *Empty, res *Pricing) error {
+	terms := s.provider.Terms()
+	res.PricePerByte = terms.PricePerByte.String()
+	res.PaymentInterval = terms.PaymentInterval
+	res.PaymentIntervalIncrease = terms.PaymentIntervalIncrease
+	return nil
+}
+
+// SetPricing sets the provider's base terms
+func (s *AdminService) SetPricing(args *Pricing, _ *Empty) error {
+	price, err := parsePricing(args.PricePerByte, args.PaymentInterval)
+	if err != nil {
+		return err
+	}
+
+	s.provider.SetPricePerByte(price)
+	s.provider.SetPaymentInterval(args.PaymentInterval, args.PaymentIntervalIncrease)
+	log.Info("pricing set to ", args.PricePerByte, " per byte, payment interval ", args.PaymentInterval,
+		", increase ", args.PaymentIntervalIncrease)
+	return nil
+}
+
+// ListInventory returns the CIDs in the provider's store
+func (s *AdminService) ListInventory(_ *Empty, res *[]string) error {
+	inv, ok := s.store.(inventory)
+	if !ok {
+		return errInventoryReadOnly
+	}
+
+	for _, c := range inv.CIDs() {
+		*res = append(*res, c.String())
+	}
+	return nil
+}
+
+// AddInventory adds CIDs to the provider's store
+func (s *AdminService) AddInventory(args *CIDsArgs, _ *Empty) error {
+	inv, ok := s.store.(inventory)
+	if !ok {
+		return errInventoryReadOnly
+	}
+
+	cids, err := decodeCIDs(args.CIDs)
+	if err != nil {
+		return err
+	}
+
+	return inv.Add(cids...)
+}
+
+// RemoveInventory removes CIDs from the provider's store
+func (s *AdminService) RemoveInventory(args *CIDsArgs, _ *Empty) error {
+	inv, ok := s.store.(inventory)
+	if !ok {
+		return errInventoryReadOnly
+	}
+
+	cids, err := decodeCIDs(args.CIDs)
+	if err != nil {
+		return err
+	}
+
+	return inv.Remove(cids...)
+}
+
+// ReloadInventory reloads the provider's store from disk
+func (s *AdminService) ReloadInventory(_ *Empty, _ *Empty) error {
+	r, ok := s.store.(reloader)
+	if !ok {
+		return errInventoryNotReloadable
+	}
+
+	return r.Reload()
+}
+
+// ListCache returns the CIDs in the provider's request cache with their records
+func (s *AdminService) ListCache(_ *Empty, res *[]CacheEntry) error {
+	for _, c := range s.cache.Keys() {
+		*res = append(*res, CacheEntry{
+			CID:    c.String(),
+			Record: s.cache.GetRecord(c),
+		})
+	}
+	return nil
+}
+
+// GetCacheRecord returns the request cache record of the given CIDs
+func (s *AdminService) GetCacheRecord(args *CIDsArgs, res *[]CacheEntry) error {
+	cids, err := decodeCIDs(args.CIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cids {
+		*res = append(*res, CacheEntry{
+			CID:    c.String(),
+			Record: s.cache.GetRecord(c),
+		})
+	}
+	return nil
+}
+
+func decodeCIDs(strs []string) ([]cid.Cid, error) {
+	cids := make([]cid.Cid, len(strs))
+	for i, str := range strs {
+		c, err := cid.Decode(str)
+		if err != nil {
+			return nil, err
+		}
+		cids[i] = c
+	}
+	return cids, nil
+}
+
+// serveAdmin serves the admin API over JSON-RPC on a unix socket at the given path, removing any stale
+// socket left by a previous run. The socket's directory is created if needed, and must only be accessible
+// by the user running the provider. The returned listener should be closed to stop serving.
+func serveAdmin(path string, svc *AdminService) (net.Listener, error) {
+	server := rpc.NewServer()
+	err := server.RegisterName(adminServiceName, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the user running the provider can administer it, so the socket is never reachable by others,
+	// even before its own permissions could be changed
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("admin socket directory %s must only be accessible by its owner, has mode %s", dir, info.Mode().Perm())
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("admin socket %s is in use by another process", path)
+		}
+
+		err = os.Remove(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+
+	return l, nil
+}
+
+// dialAdmin connects to the admin API of a provider serving on the unix socket at the given path
+func dialAdmin(path string) (*rpc.Client, error) {
+	return jsonrpc.Dial("unix", path)
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+)
+
+var (
+	adminFlag = cli.BoolFlag{
+		Name:  "admin",
+		Usage: "serve the admin API on a unix socket",
+	}
+	adminSocketFlag = cli.StringFlag{
+		Name:  "admin-socket",
+		Usage: "path of the unix socket the admin API is served on, in a directory only accessible by its owner",
+		Value: defaultAdminSocket,
+	}
+
+	priceFlag = cli.StringFlag{
+		Name:  "price",
+		Usage: "price per byte",
+	}
+	paymentIntervalFlag = cli.Uint64Flag{
+		Name:  "payment-interval",
+		Usage: "payment interval (bytes)",
+	}
+	paymentIntervalIncreaseFlag = cli.Uint64Flag{
+		Name:  "payment-interval-increase",
+		Usage: "payment interval increase (bytes)",
+	}
+
+	adminCommand = cli.Command{
+		Name:  "admin",
+		Usage: "Administer a running provider through its admin API",
+		Flags: []cli.Flag{adminSocketFlag},
+		Subcommands: []cli.Command{
+			{
+				Name:   "status",
+				Usage:  "Show the provider's identity, addresses, and cache and inventory sizes",
+				Action: adminAction("Status", noArgs),
+			},
+			{
+				Name:   "peers",
+				Usage:  "List connected peers",
+				Action: adminAction("Peers", noArgs),
+			},
+			{
+				Name:  "pricing",
+				Usage: "Get or set the provider's base pricing",
+				Subcommands: []cli.Command{
+					{
+						Name:   "get",
+						Usage:  "Show the current pricing",
+						Action: adminAction("GetPricing", noArgs),
+					},
+					{
+						Name:      "set",
+						Usage:     "Set the pricing; unset flags keep their current value",
+						UsageText: "retrieval-provider admin pricing set [--price <price>] [--payment-interval <bytes>] [--payment-interval-increase <bytes>]",
+						Flags:     []cli.Flag{priceFlag, paymentIntervalFlag, paymentIntervalIncreaseFlag},
+						Action:    setPricing,
+					},
+				},
+			},
+			{
+				Name:  "inventory",
+				Usage: "Manage the provider's available CIDs",
+				Subcommands: []cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List available CIDs",
+						Action: adminAction("ListInventory", noArgs),
+					},
+					{
+						Name:      "add",
+						Usage:     "Add available CIDs",
+						ArgsUsage: "<CID>...",
+						Action:    adminAction("AddInventory", cidArgs),
+					},
+					{
+						Name:      "remove",
+						Usage:     "Remove available CIDs",
+						ArgsUsage: "<CID>...",
+						Action:    adminAction("RemoveInventory", cidArgs),
+					},
+					{
+						Name:   "reload",
+						Usage:  "Reload the inventory from disk",
+						Action: adminAction("ReloadInventory", noArgs),
+					},
+				},
+			},
+			{
+				Name:  "cache",
+				Usage: "Inspect the provider's request cache",
+				Subcommands: []cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List cached CIDs and their records",
+						Action: adminAction("ListCache", noArgs),
+					},
+					{
+						Name:      "get",
+						Usage:     "Show the records of the given CIDs",
+						ArgsUsage: "<CID>...",
+						Action:    adminAction("GetCacheRecord", cidArgs),
+					},
+				},
+			},
+		},
+	}
+)
+
+func noArgs(ctx *cli.Context) (interface{}, error) {
+	return &Empty{}, nil
+}
+
+func cidArgs(ctx *cli.Context) (interface{}, error) {
+	if !ctx.Args().Present() {
+		return nil, fmt.Errorf("at least one CID is required")
+	}
+
+	return &CIDsArgs{CIDs: ctx.Args()}, nil
+}
+
+// adminAction returns a command action that calls the given admin method and prints its result as JSON
+func adminAction(method string, args func(*cli.Context) (interface{}, error)) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		a, err := args(ctx)
+		if err != nil {
+			return err
+		}
+
+		var res interface{}
+		err = callAdmin(ctx, method, a, &res)
+		if err != nil {
+			return err
+		}
+
+		// methods without a result return Empty
+		if m, ok := res.(map[string]interface{}); res == nil || ok && len(m) == 0 {
+			return nil
+		}
+
+		return printJSON(res)
+	}
+}
+
+func setPricing(ctx *cli.Context) error {
+	pricing := new(Pricing)
+	err := callAdmin(ctx, "GetPricing", &Empty{}, pricing)
+	if err != nil {
+		return err
+	}
+
+	if ctx.IsSet(priceFlag.Name) {
+		pricing.PricePerByte = ctx.String(priceFlag.Name)
+	}
+	if ctx.IsSet(paymentIntervalFlag.Name) {
+		pricing.PaymentInterval = ctx.Uint64(paymentIntervalFlag.Name)
+	}
+	if ctx.IsSet(paymentIntervalIncreaseFlag.Name) {
+		pricing.PaymentIntervalIncrease = ctx.Uint64(paymentIntervalIncreaseFlag.Name)
+	}
+
+	err = callAdmin(ctx, "SetPricing", pricing, &Empty{})
+	if err != nil {
+		return err
+	}
+
+	return printJSON(pricing)
+}
+
+// callAdmin calls the admin method on the provider at the admin command's socket
+func callAdmin(ctx *cli.Context, method string, args, res interface{}) error {
+	c, err := dialAdmin(ctx.GlobalString(adminSocketFlag.Name))
+	if err != nil {
+		return fmt.Errorf("failed to connect to provider: %w", err)
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	return c.Call(adminServiceName+"."+method, args, res)
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
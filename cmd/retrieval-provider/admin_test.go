@@ -0,0 +1,148 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/cache"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/cmd/utils"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/provider"
+	block "github.com/ipfs/go-block-format"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	net, err := utils.NewNetwork("", nil)
+	require.NoError(t, err)
+
+	ps, err := NewProviderStore("")
+	require.NoError(t, err)
+
+	c := cache.NewLFUCache(10)
+	p := provider.NewProvider(net, ps, c)
+
+	socket := filepath.Join(dir, "admin.sock")
+	l, err := serveAdmin(socket, &AdminService{
+		provider: p,
+		net:      net,
+		store:    ps,
+		cache:    c,
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, l.Close())
+	}()
+
+	// the socket can't be shared with another provider
+	_, err = serveAdmin(socket, &AdminService{})
+	require.Error(t, err)
+
+	client, err := dialAdmin(socket)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, client.Close())
+	}()
+
+	status := new(StatusResult)
+	err = client.Call("Admin.Status", &Empty{}, status)
+	require.NoError(t, err)
+	require.Equal(t, net.PeerID().String(), status.PeerID)
+	require.Equal(t, 0, status.Inventory)
+
+	// pricing
+	err = client.Call("Admin.SetPricing", &Pricing{PricePerByte: "7", PaymentInterval: 1, PaymentIntervalIncrease: 2}, &Empty{})
+	require.NoError(t, err)
+
+	pricing := new(Pricing)
+	err = client.Call("Admin.GetPricing", &Empty{}, pricing)
+	require.NoError(t, err)
+	require.Equal(t, &Pricing{PricePerByte: "7", PaymentInterval: 1, PaymentIntervalIncrease: 2}, pricing)
+
+	// invalid terms are rejected, and the current terms kept
+	for _, invalid := range []*Pricing{
+		{PricePerByte: "not a number", PaymentInterval: 1},
+		{PricePerByte: "-1", PaymentInterval: 1},
+		{PricePerByte: "7", PaymentInterval: 0},
+	} {
+		err = client.Call("Admin.SetPricing", invalid, &Empty{})
+		require.Error(t, err, invalid)
+	}
+
+	err = client.Call("Admin.GetPricing", &Empty{}, pricing)
+	require.NoError(t, err)
+	require.Equal(t, &Pricing{PricePerByte: "7", PaymentInterval: 1, PaymentIntervalIncrease: 2}, pricing)
+
+	// inventory
+	cidA := block.NewBlock([]byte("noot")).Cid()
+	cidB := block.NewBlock([]byte("was")).Cid()
+	err = client.Call("Admin.AddInventory", &CIDsArgs{CIDs: []string{cidA.String(), cidB.String()}}, &Empty{})
+	require.NoError(t, err)
+	err = client.Call("Admin.RemoveInventory", &CIDsArgs{CIDs: []string{cidA.String()}}, &Empty{})
+	require.NoError(t, err)
+
+	var inv []string
+	err = client.Call("Admin.ListInventory", &Empty{}, &inv)
+	require.NoError(t, err)
+	require.Equal(t, []string{cidB.String()}, inv)
+
+	err = client.Call("Admin.AddInventory", &CIDsArgs{CIDs: []string{"not a cid"}}, &Empty{})
+	require.Error(t, err)
+
+	// cache
+	c.Put(cidA)
+	var entries []CacheEntry
+	err = client.Call("Admin.ListCache", &Empty{}, &entries)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, cidA.String(), entries[0].CID)
+	require.Equal(t, 1, entries[0].Record.Frequency)
+}
+
+func TestAdminSocketPath(t *testing.T) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	defer func() {
+		_ = os.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	}()
+
+	require.NoError(t, os.Setenv("XDG_RUNTIME_DIR", "/run/user/1000"))
+	require.Equal(t, "/run/user/1000/retrieval-provider/admin.sock", adminSocketPath())
+
+	require.NoError(t, os.Unsetenv("XDG_RUNTIME_DIR"))
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, ".retrieval-provider", "admin.sock"), adminSocketPath())
+}
+
+func TestServeAdmin_PrivateDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	// the socket's directory is created only accessible by its owner
+	socket := filepath.Join(dir, "private", "admin.sock")
+	l, err := serveAdmin(socket, &AdminService{})
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	info, err := os.Stat(filepath.Dir(socket))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	// sockets in directories others can access are refused
+	require.NoError(t, os.Chmod(dir, 0755))
+	_, err = serveAdmin(filepath.Join(dir, "admin.sock"), &AdminService{})
+	require.Error(t, err)
+}
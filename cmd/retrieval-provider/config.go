@@ -0,0 +1,508 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/cmd/utils"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/network"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/provider"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	logging "github.com/ipfs/go-log/v2"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// pricing policies
+const (
+	pricingStatic = "static"
+	pricingDemand = "demand"
+)
+
+// defaultLogLevel is the default log level of the provider's own subsystems
+const defaultLogLevel = "info"
+
+// logSubsystems are the subsystems whose level is set by LogConfig.Level
+var logSubsystems = []string{"provider", "provider-main", "network", "store"}
+
+// Config is the provider's configuration, loaded from a TOML or YAML file and overridden by flags
+type Config struct {
+	Network NetworkConfig `toml:"network" yaml:"network"`
+	Store   StoreConfig   `toml:"store" yaml:"store"`
+	Pricing PricingConfig `toml:"pricing" yaml:"pricing"`
+	Queries QueriesConfig `toml:"queries" yaml:"queries"`
+	Cache   CacheConfig   `toml:"cache" yaml:"cache"`
+	Log     LogConfig     `toml:"log" yaml:"log"`
+	Admin   AdminConfig   `toml:"admin" yaml:"admin"`
+}
+
+// NetworkConfig configures the provider's libp2p host
+type NetworkConfig struct {
+	Identity    string   `toml:"identity" yaml:"identity"`       // Identity key file, created if it doesn't exist
+	ListenAddrs []string `toml:"listenAddrs" yaml:"listenAddrs"` // Multiaddrs to listen on, random ports if empty
+	Bootnodes   []string `toml:"bootnodes" yaml:"bootnodes"`     // Multiaddrs of peers to connect to on startup
+	DHT         bool     `toml:"dht" yaml:"dht"`                 // Advertise the store's CIDs on the Kademlia DHT
+
+	BufferSize     int    `toml:"bufferSize" yaml:"bufferSize"`         // Number of received gossip messages buffered until handled
+	OverflowPolicy string `toml:"overflowPolicy" yaml:"overflowPolicy"` // drop-oldest, drop-newest or block, when the buffer is full
+
+	PeerScore PeerScoreConfig `toml:"peerScore" yaml:"peerScore"`
+}
+
+// PeerScoreConfig configures gossipsub peer scoring. Peers are penalised for invalid queries, and stop
+// receiving gossip, then stop being published to, then are ignored as their score drops below each threshold.
+type PeerScoreConfig struct {
+	Enabled           bool    `toml:"enabled" yaml:"enabled"`
+	GossipThreshold   float64 `toml:"gossipThreshold" yaml:"gossipThreshold"`
+	PublishThreshold  float64 `toml:"publishThreshold" yaml:"publishThreshold"`
+	GraylistThreshold float64 `toml:"graylistThreshold" yaml:"graylistThreshold"`
+}
+
+// StoreConfig configures where the provider's CIDs are loaded from. At most one of Data and CARDir can be set.
+type StoreConfig struct {
+	Data   string `toml:"data" yaml:"data"`     // JSON file of available CIDs
+	CARDir string `toml:"carDir" yaml:"carDir"` // Directory of CAR files
+}
+
+// PricingConfig configures the terms offered by the provider
+type PricingConfig struct {
+	Policy                  string `toml:"policy" yaml:"policy"` // static or demand
+	PricePerByte            string `toml:"pricePerByte" yaml:"pricePerByte"`
+	PaymentInterval         uint64 `toml:"paymentInterval" yaml:"paymentInterval"`
+	PaymentIntervalIncrease uint64 `toml:"paymentIntervalIncrease" yaml:"paymentIntervalIncrease"`
+	PriceFloor              string `toml:"priceFloor" yaml:"priceFloor"`         // Minimum price per byte of the demand policy
+	PriceCeiling            string `toml:"priceCeiling" yaml:"priceCeiling"`     // Maximum price per byte of the demand policy
+	DemandHalfLife          string `toml:"demandHalfLife" yaml:"demandHalfLife"` // Time unrequested after which demand halves, eg. 24h
+}
+
+// QueriesConfig configures how gossiped queries are processed
+type QueriesConfig struct {
+	Workers         int    `toml:"workers" yaml:"workers"`                 // Number of queries handled at once
+	QueueSize       int    `toml:"queueSize" yaml:"queueSize"`             // Number of queries that can wait for a worker
+	QueuePolicy     string `toml:"queuePolicy" yaml:"queuePolicy"`         // drop or block, when the queue is full
+	ResponseTimeout string `toml:"responseTimeout" yaml:"responseTimeout"` // Time allowed to send each response, eg. 10s
+
+	RateLimit float64 `toml:"rateLimit" yaml:"rateLimit"` // Queries per second handled from each peer and client, 0 for no limit
+	RateBurst int     `toml:"rateBurst" yaml:"rateBurst"` // Queries a peer or client can send at once before being limited
+}
+
+// CacheConfig configures the provider's request cache
+type CacheConfig struct {
+	Size int `toml:"size" yaml:"size"` // Maximum number of CIDs whose requests are recorded
+}
+
+// LogConfig configures log levels
+type LogConfig struct {
+	Level      string            `toml:"level" yaml:"level"`           // Level of the provider's own subsystems
+	Subsystems map[string]string `toml:"subsystems" yaml:"subsystems"` // Levels of individual subsystems, eg. pubsub
+}
+
+// AdminConfig configures the admin API
+type AdminConfig struct {
+	Enabled bool   `toml:"enabled" yaml:"enabled"` // Whether the admin API is served; off by default
+	Socket  string `toml:"socket" yaml:"socket"`   // Unix socket path, in a directory only accessible by its owner
+}
+
+// DefaultConfig returns the configuration used for anything not set in the config file or by flags
+func DefaultConfig() *Config {
+	thresholds := network.DefaultPeerScoreThresholds()
+
+	return &Config{
+		Network: NetworkConfig{
+			BufferSize:     network.DefaultBufferSize,
+			OverflowPolicy: network.OverflowDropOldest.String(),
+			PeerScore: PeerScoreConfig{
+				Enabled:           true,
+				GossipThreshold:   thresholds.GossipThreshold,
+				PublishThreshold:  thresholds.PublishThreshold,
+				GraylistThreshold: thresholds.GraylistThreshold,
+			},
+		},
+		Pricing: PricingConfig{
+			Policy:                  pricingStatic,
+			PricePerByte:            provider.DefaultPricePerByte.String(),
+			PaymentInterval:         provider.DefaultPaymentInterval,
+			PaymentIntervalIncrease: provider.DefaultPaymentIntervalIncrease,
+			PriceFloor:              "0",
+			PriceCeiling:            "1000000",
+			DemandHalfLife:          provider.DefaultDemandHalfLife.String(),
+		},
+		Queries: QueriesConfig{
+			Workers:         provider.DefaultWorkers,
+			QueueSize:       provider.DefaultQueueSize,
+			QueuePolicy:     provider.QueueDrop.String(),
+			ResponseTimeout: provider.DefaultResponseTimeout.String(),
+			RateLimit:       provider.DefaultRateLimit,
+			RateBurst:       provider.DefaultRateBurst,
+		},
+		Cache: CacheConfig{
+			Size: 1024,
+		},
+		Log: LogConfig{
+			Level: defaultLogLevel,
+		},
+		Admin: AdminConfig{
+			Socket: defaultAdminSocket,
+		},
+	}
+}
+
+// LoadConfig returns the default configuration overridden by the TOML or YAML file at the given path.
+// The format is determined by the file's extension, and unknown keys are an error.
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("unknown key %s in config %s", undecoded[0], path)
+		}
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %q, must be .toml, .yaml or .yml", ext)
+	}
+
+	return cfg, nil
+}
+
+// loadConfig returns the configuration loaded from the file set by --config, or the default configuration,
+// overridden by any flags that are set, and validated
+func loadConfig(ctx *cli.Context) (*Config, error) {
+	cfg := DefaultConfig()
+	if path := ctx.String(configFlag.Name); path != "" {
+		var err error
+		cfg, err = LoadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.applyFlags(ctx)
+
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// applyFlags overrides the configuration with the flags that are set
+func (c *Config) applyFlags(ctx *cli.Context) {
+	if ctx.IsSet(utils.IdentityFlag.Name) {
+		c.Network.Identity = ctx.String(utils.IdentityFlag.Name)
+	}
+	if ctx.IsSet(utils.ListenAddrsFlag.Name) {
+		c.Network.ListenAddrs = splitList(ctx.String(utils.ListenAddrsFlag.Name))
+	}
+	if ctx.IsSet(bootnodesFlag.Name) {
+		c.Network.Bootnodes = splitList(ctx.String(bootnodesFlag.Name))
+	}
+	if ctx.IsSet(dhtFlag.Name) {
+		c.Network.DHT = ctx.Bool(dhtFlag.Name)
+	}
+	if ctx.IsSet(bufferSizeFlag.Name) {
+		c.Network.BufferSize = ctx.Int(bufferSizeFlag.Name)
+	}
+	if ctx.IsSet(overflowPolicyFlag.Name) {
+		c.Network.OverflowPolicy = ctx.String(overflowPolicyFlag.Name)
+	}
+	if ctx.IsSet(dataFlag.Name) {
+		c.Store.Data = ctx.String(dataFlag.Name)
+	}
+	if ctx.IsSet(carDirFlag.Name) {
+		c.Store.CARDir = ctx.String(carDirFlag.Name)
+	}
+	if ctx.IsSet(pricingFlag.Name) {
+		c.Pricing.Policy = ctx.String(pricingFlag.Name)
+	}
+	if ctx.IsSet(priceFlag.Name) {
+		c.Pricing.PricePerByte = ctx.String(priceFlag.Name)
+	}
+	if ctx.IsSet(paymentIntervalFlag.Name) {
+		c.Pricing.PaymentInterval = ctx.Uint64(paymentIntervalFlag.Name)
+	}
+	if ctx.IsSet(paymentIntervalIncreaseFlag.Name) {
+		c.Pricing.PaymentIntervalIncrease = ctx.Uint64(paymentIntervalIncreaseFlag.Name)
+	}
+	if ctx.IsSet(priceFloorFlag.Name) {
+		c.Pricing.PriceFloor = ctx.String(priceFloorFlag.Name)
+	}
+	if ctx.IsSet(priceCeilingFlag.Name) {
+		c.Pricing.PriceCeiling = ctx.String(priceCeilingFlag.Name)
+	}
+	if ctx.IsSet(demandHalfLifeFlag.Name) {
+		c.Pricing.DemandHalfLife = ctx.Duration(demandHalfLifeFlag.Name).String()
+	}
+	if ctx.IsSet(workersFlag.Name) {
+		c.Queries.Workers = ctx.Int(workersFlag.Name)
+	}
+	if ctx.IsSet(queueSizeFlag.Name) {
+		c.Queries.QueueSize = ctx.Int(queueSizeFlag.Name)
+	}
+	if ctx.IsSet(queuePolicyFlag.Name) {
+		c.Queries.QueuePolicy = ctx.String(queuePolicyFlag.Name)
+	}
+	if ctx.IsSet(responseTimeoutFlag.Name) {
+		c.Queries.ResponseTimeout = ctx.Duration(responseTimeoutFlag.Name).String()
+	}
+	if ctx.IsSet(rateLimitFlag.Name) {
+		c.Queries.RateLimit = ctx.Float64(rateLimitFlag.Name)
+	}
+	if ctx.IsSet(rateBurstFlag.Name) {
+		c.Queries.RateBurst = ctx.Int(rateBurstFlag.Name)
+	}
+	if ctx.IsSet(cacheSizeFlag.Name) {
+		c.Cache.Size = ctx.Int(cacheSizeFlag.Name)
+	}
+	if ctx.IsSet(logLevelFlag.Name) {
+		c.Log.Level = ctx.String(logLevelFlag.Name)
+	}
+	if ctx.IsSet(adminFlag.Name) {
+		c.Admin.Enabled = ctx.Bool(adminFlag.Name)
+	}
+	if ctx.IsSet(adminSocketFlag.Name) {
+		c.Admin.Socket = ctx.String(adminSocketFlag.Name)
+	}
+}
+
+// Validate returns an error naming the first invalid setting, if any
+func (c *Config) Validate() error {
+	for _, addr := range c.Network.ListenAddrs {
+		_, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			return fmt.Errorf("network.listenAddrs: invalid multiaddr %q: %w", addr, err)
+		}
+	}
+
+	_, err := shared.StringsToAddrInfos(c.Network.Bootnodes)
+	if err != nil {
+		return fmt.Errorf("network.bootnodes: %w", err)
+	}
+
+	if c.Network.BufferSize < 0 {
+		return fmt.Errorf("network.bufferSize: must not be negative")
+	}
+
+	_, err = network.ParseOverflowPolicy(c.Network.OverflowPolicy)
+	if err != nil {
+		return fmt.Errorf("network.overflowPolicy: %w", err)
+	}
+
+	if score := c.Network.PeerScore; score.Enabled {
+		if score.GossipThreshold > 0 {
+			return fmt.Errorf("network.peerScore.gossipThreshold: must not be positive")
+		}
+		if score.PublishThreshold > score.GossipThreshold {
+			return fmt.Errorf("network.peerScore.publishThreshold: must not be greater than gossipThreshold")
+		}
+		if score.GraylistThreshold > score.PublishThreshold {
+			return fmt.Errorf("network.peerScore.graylistThreshold: must not be greater than publishThreshold")
+		}
+	}
+
+	if c.Store.Data != "" && c.Store.CARDir != "" {
+		return fmt.Errorf("store: only one of data and carDir can be set")
+	}
+
+	_, err = parsePricing(c.Pricing.PricePerByte, c.Pricing.PaymentInterval)
+	if err != nil {
+		return fmt.Errorf("pricing.%w", err)
+	}
+
+	switch c.Pricing.Policy {
+	case pricingStatic:
+	case pricingDemand:
+		_, err = c.Pricing.demandPricing()
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("pricing.policy: unknown policy %q, must be %s or %s", c.Pricing.Policy, pricingStatic, pricingDemand)
+	}
+
+	if c.Queries.Workers <= 0 {
+		return fmt.Errorf("queries.workers: must be greater than 0")
+	}
+
+	if c.Queries.QueueSize < 0 {
+		return fmt.Errorf("queries.queueSize: must not be negative")
+	}
+
+	_, err = provider.ParseQueuePolicy(c.Queries.QueuePolicy)
+	if err != nil {
+		return fmt.Errorf("queries.queuePolicy: %w", err)
+	}
+
+	timeout, err := time.ParseDuration(c.Queries.ResponseTimeout)
+	if err != nil || timeout <= 0 {
+		return fmt.Errorf("queries.responseTimeout: invalid duration %q", c.Queries.ResponseTimeout)
+	}
+
+	if c.Queries.RateLimit < 0 {
+		return fmt.Errorf("queries.rateLimit: must not be negative")
+	}
+
+	if c.Queries.RateLimit > 0 && c.Queries.RateBurst < 1 {
+		return fmt.Errorf("queries.rateBurst: must be greater than 0")
+	}
+
+	if c.Cache.Size <= 0 {
+		return fmt.Errorf("cache.size: must be greater than 0")
+	}
+
+	_, err = logging.LevelFromString(c.Log.Level)
+	if err != nil {
+		return fmt.Errorf("log.level: invalid level %q", c.Log.Level)
+	}
+
+	for name, level := range c.Log.Subsystems {
+		_, err = logging.LevelFromString(level)
+		if err != nil {
+			return fmt.Errorf("log.subsystems.%s: invalid level %q", name, level)
+		}
+	}
+
+	if c.Admin.Enabled && c.Admin.Socket == "" {
+		return fmt.Errorf("admin.socket: must be set when the admin API is enabled")
+	}
+
+	return nil
+}
+
+// parsePricing parses the price per byte, checking that it isn't negative and that the payment interval is set
+func parsePricing(pricePerByte string, paymentInterval uint64) (big.Int, error) {
+	price, err := big.FromString(pricePerByte)
+	if err != nil {
+		return big.Zero(), fmt.Errorf("pricePerByte: invalid price %q", pricePerByte)
+	}
+
+	if price.Sign() < 0 {
+		return big.Zero(), fmt.Errorf("pricePerByte: must not be negative")
+	}
+
+	if paymentInterval == 0 {
+		return big.Zero(), fmt.Errorf("paymentInterval: must be greater than 0")
+	}
+
+	return price, nil
+}
+
+// options returns the network options of the configuration, which must be valid
+func (c *NetworkConfig) options() []network.Option {
+	overflow, _ := network.ParseOverflowPolicy(c.OverflowPolicy)
+	opts := []network.Option{
+		network.WithBufferSize(c.BufferSize),
+		network.WithOverflowPolicy(overflow),
+	}
+
+	if !c.PeerScore.Enabled {
+		return append(opts, network.WithPeerScore(nil, nil))
+	}
+
+	thresholds := network.DefaultPeerScoreThresholds()
+	thresholds.GossipThreshold = c.PeerScore.GossipThreshold
+	thresholds.PublishThreshold = c.PeerScore.PublishThreshold
+	thresholds.GraylistThreshold = c.PeerScore.GraylistThreshold
+	return append(opts, network.WithPeerScoreThresholds(thresholds))
+}
+
+// apply configures the provider's query processing. The configuration must be valid.
+func (c *QueriesConfig) apply(p *provider.Provider) {
+	policy, _ := provider.ParseQueuePolicy(c.QueuePolicy)
+	timeout, _ := time.ParseDuration(c.ResponseTimeout)
+
+	p.SetWorkers(c.Workers)
+	p.SetQueue(c.QueueSize, policy)
+	p.SetResponseTimeout(timeout)
+	p.SetRateLimit(c.RateLimit, c.RateBurst)
+}
+
+// policy returns the pricing policy of the configuration, which must be valid
+func (c *PricingConfig) policy() (provider.PricingPolicy, error) {
+	if c.Policy == pricingDemand {
+		return c.demandPricing()
+	}
+	return provider.StaticPricing{}, nil
+}
+
+func (c *PricingConfig) demandPricing() (*provider.DemandPricing, error) {
+	floor, err := big.FromString(c.PriceFloor)
+	if err != nil {
+		return nil, fmt.Errorf("pricing.priceFloor: invalid price %q", c.PriceFloor)
+	}
+
+	ceiling, err := big.FromString(c.PriceCeiling)
+	if err != nil {
+		return nil, fmt.Errorf("pricing.priceCeiling: invalid price %q", c.PriceCeiling)
+	}
+
+	halfLife, err := time.ParseDuration(c.DemandHalfLife)
+	if err != nil || halfLife < 0 {
+		return nil, fmt.Errorf("pricing.demandHalfLife: invalid duration %q", c.DemandHalfLife)
+	}
+
+	dp, err := provider.NewDemandPricing(floor, ceiling)
+	if err != nil {
+		return nil, fmt.Errorf("pricing: %w", err)
+	}
+	dp.HalfLife = halfLife
+
+	return dp, nil
+}
+
+// setLogLevels sets the level of the provider's subsystems, then of any individually configured subsystems
+func (c *LogConfig) setLogLevels() error {
+	for _, name := range logSubsystems {
+		err := logging.SetLogLevel(name, c.Level)
+		if err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(c.Subsystems))
+	for name := range c.Subsystems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		err := logging.SetLogLevel(name, c.Subsystems[name])
+		if err != nil {
+			return fmt.Errorf("log.subsystems.%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func splitList(str string) []string {
+	if str == "" {
+		return nil
+	}
+	return strings.Split(str, ",")
+}
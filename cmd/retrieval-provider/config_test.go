@@ -0,0 +1,165 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/provider"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func writeTestConfig(t *testing.T, name, data string) string {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	path := filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, []byte(data), 0644)
+	require.NoError(t, err)
+	return path
+}
+
+func TestLoadConfig_Example(t *testing.T) {
+	cfg, err := LoadConfig("config.example.toml")
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, []string{"/ip4/0.0.0.0/tcp/4001"}, cfg.Network.ListenAddrs)
+	require.Equal(t, "cids.json", cfg.Store.Data)
+	require.Equal(t, "2", cfg.Pricing.PricePerByte)
+	require.Equal(t, 1024, cfg.Cache.Size)
+	require.Equal(t, "10s", cfg.Queries.ResponseTimeout)
+	require.Equal(t, DefaultConfig().Network.PeerScore, cfg.Network.PeerScore)
+	require.Equal(t, map[string]string{"pubsub": "warn"}, cfg.Log.Subsystems)
+	require.False(t, cfg.Admin.Enabled)
+	require.Equal(t, defaultAdminSocket, cfg.Admin.Socket)
+}
+
+func TestLoadConfig(t *testing.T) {
+	toml := writeTestConfig(t, "config.toml", `
+[pricing]
+policy = "demand"
+pricePerByte = "5"
+
+[cache]
+size = 10
+`)
+	yaml := writeTestConfig(t, "config.yaml", `
+pricing:
+  policy: demand
+  pricePerByte: "5"
+cache:
+  size: 10
+`)
+
+	for _, path := range []string{toml, yaml} {
+		cfg, err := LoadConfig(path)
+		require.NoError(t, err)
+		require.NoError(t, cfg.Validate())
+		require.Equal(t, "demand", cfg.Pricing.Policy)
+		require.Equal(t, "5", cfg.Pricing.PricePerByte)
+		require.Equal(t, 10, cfg.Cache.Size)
+
+		// unset values keep their defaults
+		require.Equal(t, provider.DefaultPaymentInterval, cfg.Pricing.PaymentInterval)
+		require.Equal(t, defaultLogLevel, cfg.Log.Level)
+	}
+
+	for _, path := range []string{
+		writeTestConfig(t, "unknown.toml", "[cache]\nsise = 10\n"),
+		writeTestConfig(t, "unknown.yaml", "cache:\n  sise: 10\n"),
+		writeTestConfig(t, "invalid.toml", "[cache\n"),
+		writeTestConfig(t, "config.json", "{}"),
+	} {
+		_, err := LoadConfig(path)
+		require.Error(t, err, path)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(cfg *Config)
+	}{
+		{"listen addr", func(cfg *Config) { cfg.Network.ListenAddrs = []string{"not a multiaddr"} }},
+		{"bootnode", func(cfg *Config) { cfg.Network.Bootnodes = []string{"/ip4/127.0.0.1/tcp/4001"} }},
+		{"buffer size", func(cfg *Config) { cfg.Network.BufferSize = -1 }},
+		{"overflow policy", func(cfg *Config) { cfg.Network.OverflowPolicy = "drop-random" }},
+		{"gossip threshold", func(cfg *Config) { cfg.Network.PeerScore.GossipThreshold = 1 }},
+		{"graylist threshold", func(cfg *Config) { cfg.Network.PeerScore.GraylistThreshold = 0 }},
+		{"store", func(cfg *Config) { cfg.Store.Data, cfg.Store.CARDir = "cids.json", "cars" }},
+		{"price", func(cfg *Config) { cfg.Pricing.PricePerByte = "free" }},
+		{"negative price", func(cfg *Config) { cfg.Pricing.PricePerByte = "-1" }},
+		{"payment interval", func(cfg *Config) { cfg.Pricing.PaymentInterval = 0 }},
+		{"policy", func(cfg *Config) { cfg.Pricing.Policy = "auction" }},
+		{"price floor", func(cfg *Config) { cfg.Pricing.Policy, cfg.Pricing.PriceFloor = pricingDemand, "x" }},
+		{"price bounds", func(cfg *Config) { cfg.Pricing.Policy, cfg.Pricing.PriceFloor = pricingDemand, "2000000" }},
+		{"demand half-life", func(cfg *Config) { cfg.Pricing.Policy, cfg.Pricing.DemandHalfLife = pricingDemand, "-1h" }},
+		{"workers", func(cfg *Config) { cfg.Queries.Workers = 0 }},
+		{"queue size", func(cfg *Config) { cfg.Queries.QueueSize = -1 }},
+		{"queue policy", func(cfg *Config) { cfg.Queries.QueuePolicy = "retry" }},
+		{"response timeout", func(cfg *Config) { cfg.Queries.ResponseTimeout = "soon" }},
+		{"rate limit", func(cfg *Config) { cfg.Queries.RateLimit = -1 }},
+		{"rate burst", func(cfg *Config) { cfg.Queries.RateBurst = 0 }},
+		{"cache size", func(cfg *Config) { cfg.Cache.Size = 0 }},
+		{"log level", func(cfg *Config) { cfg.Log.Level = "loud" }},
+		{"subsystem log level", func(cfg *Config) { cfg.Log.Subsystems = map[string]string{"pubsub": "loud"} }},
+		{"admin socket", func(cfg *Config) { cfg.Admin.Enabled, cfg.Admin.Socket = true, "" }},
+	}
+
+	require.NoError(t, DefaultConfig().Validate())
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tc.modify(cfg)
+			require.Error(t, cfg.Validate())
+		})
+	}
+}
+
+func TestConfig_ApplyFlags(t *testing.T) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range flags {
+		f.Apply(set)
+	}
+
+	err := set.Parse([]string{
+		"--listen-addrs", "/ip4/127.0.0.1/tcp/4001,/ip4/127.0.0.1/tcp/4002",
+		"--price", "7",
+		"--cache-size", "16",
+		"--queue-policy", "block",
+		"--response-timeout", "3s",
+		"--rate-limit", "0.5",
+		"--dht",
+		"--demand-half-life", "1h",
+		"--log-level", "debug",
+	})
+	require.NoError(t, err)
+
+	cfg := DefaultConfig()
+	cfg.Pricing.PaymentInterval = 100
+	cfg.applyFlags(cli.NewContext(app, set, nil))
+
+	require.Equal(t, []string{"/ip4/127.0.0.1/tcp/4001", "/ip4/127.0.0.1/tcp/4002"}, cfg.Network.ListenAddrs)
+	require.Equal(t, "7", cfg.Pricing.PricePerByte)
+	require.Equal(t, 16, cfg.Cache.Size)
+	require.Equal(t, "block", cfg.Queries.QueuePolicy)
+	require.Equal(t, "3s", cfg.Queries.ResponseTimeout)
+	require.Equal(t, 0.5, cfg.Queries.RateLimit)
+	require.True(t, cfg.Network.DHT)
+	require.Equal(t, "1h0m0s", cfg.Pricing.DemandHalfLife)
+	require.Equal(t, "debug", cfg.Log.Level)
+
+	// flags that aren't set don't override the config, even if they have a default value
+	require.Equal(t, uint64(100), cfg.Pricing.PaymentInterval)
+	require.Equal(t, defaultAdminSocket, cfg.Admin.Socket)
+}
@@ -4,33 +4,138 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/cache"
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/cmd/utils"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/network"
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/provider"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/store"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
 	logging "github.com/ipfs/go-log/v2"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
 	"github.com/urfave/cli"
 )
 
 var (
 	log = logging.Logger("provider-main")
 
+	configFlag = cli.StringFlag{
+		Name:  "config",
+		Usage: "TOML or YAML config file, overridden by any other flags that are set",
+	}
 	dataFlag = cli.StringFlag{
 		Name:  "data",
-		Usage: "JSON file of available CIDs",
+		Usage: "JSON file of available CIDs, watched for changes and reloaded on SIGHUP",
+	}
+	carDirFlag = cli.StringFlag{
+		Name:  "car-dir",
+		Usage: "directory of CAR files to serve, watched for changes and reloaded on SIGHUP",
 	}
 	bootnodesFlag = cli.StringFlag{
 		Name:  "bootnodes",
 		Usage: "comma-separated list of peer addresses",
 	}
+	dhtFlag = cli.BoolFlag{
+		Name:  "dht",
+		Usage: "advertise the store's CIDs on the Kademlia DHT, so clients can find the provider without gossiping",
+	}
+	bufferSizeFlag = cli.IntFlag{
+		Name:  "buffer-size",
+		Usage: "number of received gossip messages buffered until they are handled",
+		Value: network.DefaultBufferSize,
+	}
+	overflowPolicyFlag = cli.StringFlag{
+		Name:  "overflow-policy",
+		Usage: "what to do with received gossip messages when the buffer is full: drop-oldest, drop-newest or block (default: drop-oldest)",
+	}
+	pricingFlag = cli.StringFlag{
+		Name:  "pricing",
+		Usage: "pricing policy to use: static or demand (default: static)",
+	}
+	priceFloorFlag = cli.StringFlag{
+		Name:  "price-floor",
+		Usage: "minimum price per byte offered by the demand pricing policy (default: 0)",
+	}
+	priceCeilingFlag = cli.StringFlag{
+		Name:  "price-ceiling",
+		Usage: "maximum price per byte offered by the demand pricing policy (default: 1000000)",
+	}
+	demandHalfLifeFlag = cli.DurationFlag{
+		Name:  "demand-half-life",
+		Usage: "time a CID goes unrequested after which its demand counts half as much in the demand pricing policy, or 0 to ignore recency",
+		Value: provider.DefaultDemandHalfLife,
+	}
+	workersFlag = cli.IntFlag{
+		Name:  "workers",
+		Usage: "number of gossiped queries handled at once",
+		Value: provider.DefaultWorkers,
+	}
+	queueSizeFlag = cli.IntFlag{
+		Name:  "queue-size",
+		Usage: "number of gossiped queries that can wait for a worker",
+		Value: provider.DefaultQueueSize,
+	}
+	queuePolicyFlag = cli.StringFlag{
+		Name:  "queue-policy",
+		Usage: "what to do with gossiped queries when the queue is full: drop, or block to apply backpressure (default: drop)",
+	}
+	responseTimeoutFlag = cli.DurationFlag{
+		Name:  "response-timeout",
+		Usage: "time allowed to connect to a client and send each response",
+		Value: provider.DefaultResponseTimeout,
+	}
+	rateLimitFlag = cli.Float64Flag{
+		Name:  "rate-limit",
+		Usage: "queries per second handled from each peer and client, or 0 for no limit",
+		Value: provider.DefaultRateLimit,
+	}
+	rateBurstFlag = cli.IntFlag{
+		Name:  "rate-burst",
+		Usage: "queries a peer or client can send at once before being rate limited",
+		Value: provider.DefaultRateBurst,
+	}
+	cacheSizeFlag = cli.IntFlag{
+		Name:  "cache-size",
+		Usage: "maximum number of CIDs whose requests are recorded for pricing",
+		Value: 1024,
+	}
+	logLevelFlag = cli.StringFlag{
+		Name:  "log-level",
+		Usage: "log level of the provider: debug, info, warn or error (default: " + defaultLogLevel + ")",
+	}
 
 	flags = []cli.Flag{
+		configFlag,
 		dataFlag,
+		carDirFlag,
 		bootnodesFlag,
+		dhtFlag,
+		utils.IdentityFlag,
+		utils.ListenAddrsFlag,
+		bufferSizeFlag,
+		overflowPolicyFlag,
+		pricingFlag,
+		priceFlag,
+		paymentIntervalFlag,
+		paymentIntervalIncreaseFlag,
+		priceFloorFlag,
+		priceCeilingFlag,
+		demandHalfLifeFlag,
+		workersFlag,
+		queueSizeFlag,
+		queuePolicyFlag,
+		responseTimeoutFlag,
+		rateLimitFlag,
+		rateBurstFlag,
+		cacheSizeFlag,
+		logLevelFlag,
+		adminFlag,
+		adminSocketFlag,
 	}
 
 	app = cli.NewApp()
@@ -39,6 +144,7 @@ var (
 func init() {
 	app.Action = run
 	app.Flags = flags
+	app.Commands = []cli.Command{adminCommand, utils.KeygenCommand}
 }
 
 func main() {
@@ -49,48 +155,159 @@ func main() {
 }
 
 func run(ctx *cli.Context) error {
-	err := logging.SetLogLevel("provider", "debug")
+	cfg, err := loadConfig(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = logging.SetLogLevel("provider-main", "debug")
+	err = cfg.Log.setLogLevels()
 	if err != nil {
 		return err
 	}
 
-	dataStr := ctx.String(dataFlag.Name)
-	bootnodesStr := ctx.String(bootnodesFlag.Name)
+	runCtx, cancel := utils.ShutdownContext()
+	defer cancel()
 
-	psJSON := new(ProviderStoreJSON)
+	ps, err := newStore(cfg.Store)
+	if err != nil {
+		return err
+	}
 
-	if dataStr != "" {
-		data, err := ioutil.ReadFile(dataStr)
-		if err != nil {
-			return err
+	defer func() {
+		if s, ok := ps.(stopper); ok {
+			_ = s.Stop()
 		}
+	}()
 
-		err = json.Unmarshal(data, &psJSON.cids)
-		if err != nil {
-			return err
-		}
+	if r, ok := ps.(reloader); ok {
+		reloadOnSIGHUP(r)
+	}
+
+	hostOpts, err := utils.HostOptions(cfg.Network.Identity, cfg.Network.ListenAddrs)
+	if err != nil {
+		return err
 	}
 
-	ps := psJSON.ToProviderStore()
+	net, err := utils.NewNetwork(strings.Join(cfg.Network.Bootnodes, ","), hostOpts, cfg.Network.options()...)
+	if err != nil {
+		return err
+	}
 
-	net, err := utils.NewNetwork(bootnodesStr)
+	pricing, err := cfg.Pricing.policy()
 	if err != nil {
 		return err
 	}
 
-	log.Debug("provider has ", ps.cids)
+	// the price is validated by loadConfig
+	price, _ := big.FromString(cfg.Pricing.PricePerByte)
+
+	c := cache.NewLFUCache(cfg.Cache.Size)
+	p := provider.NewProvider(net, ps, c)
+	p.SetPricePerByte(price)
+	p.SetPaymentInterval(cfg.Pricing.PaymentInterval, cfg.Pricing.PaymentIntervalIncrease)
+	p.SetPricingPolicy(pricing)
+	cfg.Queries.apply(p)
+
+	if cfg.Network.DHT {
+		d, err := utils.NewDHT(runCtx, net, dht.ModeServer)
+		if err != nil {
+			return fmt.Errorf("failed to start DHT: %w", err)
+		}
+
+		defer func() {
+			_ = d.Close()
+		}()
+
+		p.SetContentRouting(d, provider.DefaultReprovideInterval)
+	}
 
-	p := provider.NewProvider(net, ps, cache.NewLFUCache(1024))
-	err = p.Start()
+	err = p.Start(runCtx)
 	if err != nil {
 		return err
 	}
 
+	if cfg.Admin.Enabled {
+		socket := cfg.Admin.Socket
+		l, err := serveAdmin(socket, &AdminService{
+			provider: p,
+			net:      net,
+			store:    ps,
+			cache:    c,
+		})
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			_ = l.Close()
+		}()
+
+		log.Info("admin API listening at ", socket)
+	}
+
 	log.Info("provider listening at ", net.MultiAddrs())
-	select {}
+	<-runCtx.Done()
+
+	log.Info("shutting down")
+	stopCtx, cancelStop := utils.StopContext()
+	defer cancelStop()
+	return p.Stop(stopCtx)
+}
+
+func newStore(cfg StoreConfig) (provider.RetrievalProviderStore, error) {
+	if cfg.CARDir != "" {
+		cs, err := store.NewCARStore(cfg.CARDir)
+		if err != nil {
+			return nil, err
+		}
+
+		err = cs.Start()
+		if err != nil {
+			return nil, err
+		}
+
+		log.Debug("provider has ", cs.Len(), " cids in ", cfg.CARDir)
+		return cs, nil
+	}
+
+	ps, err := NewProviderStore(cfg.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ps.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("provider has ", ps.CIDs())
+	return ps, nil
+}
+
+// stopper is implemented by stores that watch their inventory for changes
+type stopper interface {
+	Stop() error
+}
+
+// reloader is implemented by stores that can reload their inventory from disk
+type reloader interface {
+	Reload() error
+}
+
+// reloadOnSIGHUP reloads the store's inventory whenever the process receives SIGHUP
+func reloadOnSIGHUP(s reloader) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+
+	go func() {
+		for range sigs {
+			err := s.Reload()
+			if err != nil {
+				log.Error("failed to reload store; error: ", err)
+				continue
+			}
+
+			log.Info("reloaded store")
+		}
+	}()
 }
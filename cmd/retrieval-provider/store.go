@@ -4,15 +4,59 @@
 package main
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/store"
 	"github.com/ipfs/go-cid"
 )
 
+// ProviderStore is a set of available CIDs, optionally backed by a JSON file containing a list of CID strings.
+// It can be safely modified while the provider is running, either with Add and Remove, which write through to
+// the file, or by editing the file, which is reloaded on Reload or when a change is detected while watching.
 type ProviderStore struct {
-	cids map[cid.Cid]struct{}
+	path         string
+	pollInterval time.Duration
+
+	// writeLock serializes changes to the set and its file, so that lock is only held to swap in a new set
+	writeLock sync.Mutex
+	lock      sync.RWMutex
+	cids      map[cid.Cid]struct{}
+	modTime   time.Time
+	size      int64
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewProviderStore returns a ProviderStore loaded from the JSON file at the given path.
+// If the path is empty, the store starts empty and is only modified with Add and Remove.
+func NewProviderStore(path string) (*ProviderStore, error) {
+	s := &ProviderStore{
+		path:         path,
+		pollInterval: store.DefaultPollInterval,
+		cids:         make(map[cid.Cid]struct{}),
+	}
+
+	err := s.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
 }
 
+// Has returns whether the store has the payload CID or the piece CID of the params
 func (s *ProviderStore) Has(params shared.Params) (bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	if _, has := s.cids[params.PayloadCID]; has {
 		return true, nil
 	}
@@ -26,23 +70,256 @@ func (s *ProviderStore) Has(params shared.Params) (bool, error) {
 	return false, nil
 }
 
-type ProviderStoreJSON struct {
-	cids []string
+// CIDs returns the CIDs in the store
+func (s *ProviderStore) CIDs() []cid.Cid {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	cids := make([]cid.Cid, 0, len(s.cids))
+	for c := range s.cids {
+		cids = append(cids, c)
+	}
+	return cids
+}
+
+// Add adds the CIDs to the store, writing them to its file if it has one
+func (s *ProviderStore) Add(cids ...cid.Cid) error {
+	return s.update(func(set map[cid.Cid]struct{}) {
+		for _, c := range cids {
+			set[c] = struct{}{}
+		}
+	})
+}
+
+// Remove removes the CIDs from the store, removing them from its file if it has one
+func (s *ProviderStore) Remove(cids ...cid.Cid) error {
+	return s.update(func(set map[cid.Cid]struct{}) {
+		for _, c := range cids {
+			delete(set, c)
+		}
+	})
+}
+
+// update applies fn to a copy of the store's set and writes it to the file, then swaps it in.
+// The file is reloaded first if it was changed since it was last loaded, so edits that haven't been picked up
+// by the watcher yet aren't overwritten. If the write fails, the store keeps its current set.
+func (s *ProviderStore) update(fn func(set map[cid.Cid]struct{})) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	if s.path != "" {
+		info, err := os.Stat(s.path)
+		switch {
+		case os.IsNotExist(err):
+			// the file is recreated by the write
+		case err != nil:
+			return err
+		case s.changed(info):
+			err = s.reload()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	s.lock.RLock()
+	set := make(map[cid.Cid]struct{}, len(s.cids))
+	for c := range s.cids {
+		set[c] = struct{}{}
+	}
+	s.lock.RUnlock()
+
+	fn(set)
+
+	info, err := s.write(set)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cids = set
+	if info != nil {
+		// don't reload our own write
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	return nil
 }
 
-func (s *ProviderStoreJSON) ToProviderStore() *ProviderStore {
-	ps := &ProviderStore{
-		cids: make(map[cid.Cid]struct{}),
+// changed returns whether the file info differs from that of the file when it was last loaded or written
+func (s *ProviderStore) changed(info os.FileInfo) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+}
+
+// Reload replaces the contents of the store with the contents of its file.
+// Invalid CIDs in the file are logged and skipped.
+func (s *ProviderStore) Reload() error {
+	if s.path == "" {
+		return nil
+	}
+
+	// serialize with Add and Remove so their writes aren't lost
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	return s.reload()
+}
+
+// reload replaces the contents of the store with the contents of its file. writeLock must be held.
+func (s *ProviderStore) reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var strs []string
+	err = json.Unmarshal(data, &strs)
+	if err != nil {
+		return err
 	}
 
-	for _, s := range s.cids {
-		cid, err := cid.Decode(s)
+	cids := make(map[cid.Cid]struct{})
+	for _, str := range strs {
+		c, err := cid.Decode(str)
 		if err != nil {
+			log.Warn("skipping invalid cid ", str, "; error: ", err)
 			continue
 		}
 
-		ps.cids[cid] = struct{}{}
+		cids[c] = struct{}{}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cids = cids
+	s.modTime, s.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// Start starts watching the store's file for changes
+func (s *ProviderStore) Start() error {
+	if s.path == "" {
+		return nil
+	}
+
+	if s.stop != nil {
+		return store.ErrAlreadyStarted
+	}
+
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go s.watch()
+	return nil
+}
+
+// Stop stops watching the store's file
+func (s *ProviderStore) Stop() error {
+	if s.stop == nil {
+		return nil
+	}
+
+	close(s.stop)
+	s.wg.Wait()
+	s.stop = nil
+	return nil
+}
+
+func (s *ProviderStore) watch() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(s.path)
+			if err != nil {
+				log.Error("failed to stat data file; error: ", err)
+				continue
+			}
+
+			if !s.changed(info) {
+				continue
+			}
+
+			err = s.Reload()
+			if err != nil {
+				log.Error("failed to reload data file; error: ", err)
+				continue
+			}
+
+			log.Info("reloaded data file ", s.path)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// write atomically replaces the store's file, if it has one, with the given CIDs, by writing them to a
+// temporary file and renaming it. The file keeps its permissions, or is created with mode 0644.
+// It returns the new file's info, or nil if the store has no file.
+func (s *ProviderStore) write(cids map[cid.Cid]struct{}) (os.FileInfo, error) {
+	if s.path == "" {
+		return nil, nil
+	}
+
+	mode := os.FileMode(0644)
+	info, err := os.Stat(s.path)
+	switch {
+	case err == nil:
+		mode = info.Mode().Perm()
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	strs := make([]string, 0, len(cids))
+	for c := range cids {
+		strs = append(strs, c.String())
+	}
+	sort.Strings(strs)
+
+	data, err := json.MarshalIndent(strs, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// no-op once the file has been renamed
+		_ = os.Remove(tmp.Name())
+	}()
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		_ = tmp.Close()
+		return nil, err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(tmp.Name(), mode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		return nil, err
 	}
 
-	return ps
+	return os.Stat(s.path)
 }
@@ -0,0 +1,170 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestData(t *testing.T, path string, cids ...cid.Cid) {
+	strs := []string{"not a cid"}
+	for _, c := range cids {
+		strs = append(strs, c.String())
+	}
+
+	data, err := json.Marshal(strs)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, data, 0644))
+}
+
+func requireHas(t *testing.T, s *ProviderStore, c cid.Cid, expected bool) {
+	has, err := s.Has(shared.Params{PayloadCID: c})
+	require.NoError(t, err)
+	require.Equal(t, expected, has, c)
+}
+
+func TestProviderStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "providerstore")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	a := block.NewBlock([]byte("noot")).Cid()
+	b := block.NewBlock([]byte("was")).Cid()
+	c := block.NewBlock([]byte("here")).Cid()
+
+	path := filepath.Join(dir, "data.json")
+	writeTestData(t, path, a)
+
+	s, err := NewProviderStore(path)
+	require.NoError(t, err)
+	requireHas(t, s, a, true)
+	requireHas(t, s, b, false)
+
+	// Add and Remove write through to the file
+	require.NoError(t, s.Add(b, c))
+	require.NoError(t, s.Remove(a))
+	requireHas(t, s, a, false)
+	requireHas(t, s, b, true)
+
+	reloaded, err := NewProviderStore(path)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []cid.Cid{b, c}, reloaded.CIDs())
+
+	// changes to the file are picked up by Reload
+	writeTestData(t, path, a)
+	require.NoError(t, s.Reload())
+	require.ElementsMatch(t, []cid.Cid{a}, s.CIDs())
+}
+
+func TestProviderStore_Watch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "providerstore")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	a := block.NewBlock([]byte("noot")).Cid()
+
+	path := filepath.Join(dir, "data.json")
+	writeTestData(t, path)
+
+	s, err := NewProviderStore(path)
+	require.NoError(t, err)
+	s.pollInterval = 10 * time.Millisecond
+
+	require.NoError(t, s.Start())
+	defer func() {
+		require.NoError(t, s.Stop())
+	}()
+
+	// ensure the modification time changes on filesystems with coarse timestamps
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(-time.Minute)))
+	require.NoError(t, s.Reload())
+	writeTestData(t, path, a)
+
+	require.Eventually(t, func() bool {
+		has, err := s.Has(shared.Params{PayloadCID: a})
+		return err == nil && has
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestProviderStore_NoFile(t *testing.T) {
+	s, err := NewProviderStore("")
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+
+	a := block.NewBlock([]byte("noot")).Cid()
+	require.NoError(t, s.Add(a))
+	requireHas(t, s, a, true)
+	require.NoError(t, s.Remove(a))
+	requireHas(t, s, a, false)
+}
+
+func TestProviderStore_WriteFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "providerstore")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	a := block.NewBlock([]byte("noot")).Cid()
+	b := block.NewBlock([]byte("was")).Cid()
+
+	path := filepath.Join(dir, "data.json")
+	writeTestData(t, path, a)
+
+	s, err := NewProviderStore(path)
+	require.NoError(t, err)
+
+	// the file can't be written once its directory is gone, so the store keeps its current set
+	require.NoError(t, os.RemoveAll(dir))
+	require.Error(t, s.Add(b))
+	require.Error(t, s.Remove(a))
+	require.ElementsMatch(t, []cid.Cid{a}, s.CIDs())
+}
+
+func TestProviderStore_ExternalChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "providerstore")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	a := block.NewBlock([]byte("noot")).Cid()
+	b := block.NewBlock([]byte("was")).Cid()
+	c := block.NewBlock([]byte("here")).Cid()
+
+	path := filepath.Join(dir, "data.json")
+	writeTestData(t, path, a)
+	require.NoError(t, os.Chmod(path, 0600))
+
+	s, err := NewProviderStore(path)
+	require.NoError(t, err)
+
+	// an edit that hasn't been reloaded yet isn't overwritten by Add
+	writeTestData(t, path, a, b)
+	require.NoError(t, s.Add(c))
+	require.ElementsMatch(t, []cid.Cid{a, b, c}, s.CIDs())
+
+	reloaded, err := NewProviderStore(path)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []cid.Cid{a, b, c}, reloaded.CIDs())
+
+	// and the file keeps its permissions
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
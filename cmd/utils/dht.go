@@ -0,0 +1,28 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package utils
+
+import (
+	"context"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/network"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+)
+
+// NewDHT returns a Kademlia DHT in the given mode on the network's host, bootstrapped from the peers the host
+// is connected to. It runs until it is closed or the context is done.
+func NewDHT(ctx context.Context, n *network.Network, mode dht.ModeOpt) (*dht.IpfsDHT, error) {
+	d, err := dht.New(ctx, n.Host(), dht.Mode(mode))
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.Bootstrap(ctx)
+	if err != nil {
+		_ = d.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/urfave/cli"
+)
+
+var (
+	// IdentityFlag is the file containing the libp2p identity key, created if it doesn't exist
+	IdentityFlag = cli.StringFlag{
+		Name:  "identity",
+		Usage: "file containing the libp2p identity key, created if it doesn't exist (a random identity is used if unset)",
+	}
+
+	// ListenAddrsFlag is the comma-separated list of multiaddrs to listen for libp2p connections on
+	ListenAddrsFlag = cli.StringFlag{
+		Name:  "listen-addrs",
+		Usage: "comma-separated list of multiaddrs to listen on, eg. /ip4/0.0.0.0/tcp/4001 (random ports if unset)",
+	}
+
+	// KeygenCommand generates an identity key file and prints its peer ID
+	KeygenCommand = cli.Command{
+		Name:      "keygen",
+		Usage:     "Generate a libp2p identity key file for use with --identity",
+		ArgsUsage: "<file>",
+		Action:    runKeygen,
+	}
+)
+
+// HostOptionsFromFlags returns the libp2p options set by IdentityFlag and ListenAddrsFlag
+func HostOptionsFromFlags(ctx *cli.Context) ([]libp2p.Option, error) {
+	var listenAddrs []string
+	if addrsStr := ctx.GlobalString(ListenAddrsFlag.Name); addrsStr != "" {
+		listenAddrs = strings.Split(addrsStr, ",")
+	}
+
+	return HostOptions(ctx.GlobalString(IdentityFlag.Name), listenAddrs)
+}
+
+// HostOptions returns the libp2p options for a host with the identity key in the given file, created if it
+// doesn't exist, listening on the given multiaddrs. Empty values are left to the libp2p defaults.
+func HostOptions(identity string, listenAddrs []string) ([]libp2p.Option, error) {
+	var opts []libp2p.Option
+
+	if identity != "" {
+		key, err := LoadOrGenerateKey(identity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load identity: %w", err)
+		}
+		opts = append(opts, libp2p.Identity(key))
+	}
+
+	if len(listenAddrs) > 0 {
+		for _, addr := range listenAddrs {
+			_, err := ma.NewMultiaddr(addr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid listen address %q: %w", addr, err)
+			}
+		}
+		opts = append(opts, libp2p.ListenAddrStrings(listenAddrs...))
+	}
+
+	return opts, nil
+}
+
+func runKeygen(ctx *cli.Context) error {
+	path := ctx.Args().First()
+	if path == "" {
+		return fmt.Errorf("usage: keygen <file>")
+	}
+
+	key, err := GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	err = WriteKey(path, key)
+	if err != nil {
+		return err
+	}
+
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(ctx.App.Writer, id)
+	return err
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+)
+
+// GenerateKey returns a new Ed25519 libp2p identity key
+func GenerateKey() (crypto.PrivKey, error) {
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	return key, err
+}
+
+// WriteKey writes the marshalled key to a new file at the given path, readable only by the current user.
+// It fails if the file already exists, so an identity is never overwritten by accident.
+func WriteKey(path string, key crypto.PrivKey) error {
+	data, err := crypto.MarshalPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// LoadKey reads a key written by WriteKey from the file at the given path
+func LoadKey(path string) (crypto.PrivKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := crypto.UnmarshalPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+
+	return key, nil
+}
+
+// LoadOrGenerateKey reads the key from the file at the given path, generating and writing a new key
+// to it if the file doesn't exist
+func LoadOrGenerateKey(path string) (crypto.PrivKey, error) {
+	key, err := LoadKey(path)
+	if err == nil || !os.IsNotExist(err) {
+		return key, err
+	}
+
+	key, err = GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	err = WriteKey(path, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteLoadKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "identity")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "key")
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	err = WriteKey(path, key)
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := LoadKey(path)
+	require.NoError(t, err)
+	require.True(t, key.Equals(loaded))
+
+	// existing keys are never overwritten
+	other, err := GenerateKey()
+	require.NoError(t, err)
+	err = WriteKey(path, other)
+	require.Error(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "invalid"), []byte("not a key"), 0600)
+	require.NoError(t, err)
+	_, err = LoadKey(filepath.Join(dir, "invalid"))
+	require.Error(t, err)
+}
+
+func TestLoadOrGenerateKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "identity")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "key")
+	key, err := LoadOrGenerateKey(path)
+	require.NoError(t, err)
+
+	loaded, err := LoadOrGenerateKey(path)
+	require.NoError(t, err)
+	require.True(t, key.Equals(loaded))
+}
+
+func TestNewNetwork_Options(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	id, err := peer.IDFromPrivateKey(key)
+	require.NoError(t, err)
+
+	n, err := NewNetwork("", []libp2p.Option{libp2p.Identity(key), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0")})
+	require.NoError(t, err)
+	require.Equal(t, id, n.PeerID())
+	require.Len(t, n.MultiAddrs(), 1)
+	require.Contains(t, n.MultiAddrs()[0], "/ip4/127.0.0.1/tcp/")
+}
@@ -14,14 +14,16 @@ import (
 	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
-func NewNetwork(bootnodesStr string) (*network.Network, error) {
+// NewNetwork returns a network configured with the given network options, on a new libp2p host created
+// with the given host options, connected to the comma-separated list of bootnodes
+func NewNetwork(bootnodesStr string, hostOpts []libp2p.Option, netOpts ...network.Option) (*network.Network, error) {
 	ctx := context.Background()
-	h, err := libp2p.New(ctx)
+	h, err := libp2p.New(ctx, hostOpts...)
 	if err != nil {
 		return nil, err
 	}
 
-	n, err := network.NewNetwork(h)
+	n, err := network.NewNetwork(h, netOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -10,7 +10,7 @@ import (
 )
 
 func TestBootstrap(t *testing.T) {
-	net0, err := NewNetwork("")
+	net0, err := NewNetwork("", nil)
 	require.NoError(t, err)
 
 	maddrs := net0.MultiAddrs()
@@ -23,7 +23,7 @@ func TestBootstrap(t *testing.T) {
 		}
 	}
 
-	net1, err := NewNetwork(str)
+	net1, err := NewNetwork(str, nil)
 	require.NoError(t, err)
 	require.GreaterOrEqual(t, len(net1.Peers()), 1)
 }
@@ -0,0 +1,41 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package utils
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ShutdownTimeout is how long commands wait for in-flight work to finish when shutting down
+var ShutdownTimeout = 10 * time.Second
+
+// ShutdownContext returns a context that is cancelled when the process receives SIGINT or SIGTERM,
+// or when the returned cancel func is called
+func ShutdownContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		defer signal.Stop(sigs)
+
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// StopContext returns a context for stopping services that is done after ShutdownTimeout
+func StopContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), ShutdownTimeout)
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	gen "github.com/whyrusleeping/cbor-gen"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+)
+
+const (
+	output        = "./shared/cbor_gen.go"
+	copyrightFile = "./scripts/copyright.txt"
+)
+
+// generates the CBOR encoders for the wire types
+// run with `make gen` from the repository root
+func main() {
+	err := gen.WriteTupleEncodersToFile(output, "shared",
+		shared.Params{},
+		shared.Constraints{},
+		shared.QueryResponse{},
+	)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// prepend the license header expected by scripts/add_license.sh
+	err = prependCopyright(output)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func prependCopyright(fname string) error {
+	header, err := ioutil.ReadFile(copyrightFile)
+	if err != nil {
+		return err
+	}
+
+	src, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fname, append(header, src...), 0644)
+}
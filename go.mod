@@ -3,26 +3,31 @@ module github.com/ChainSafe/fil-secondary-retrieval-markets
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/ChainSafe/go-lfu v0.0.0-20200709222421-81e9638081bd
 	github.com/davidlazar/go-crypto v0.0.0-20190912175916-7055855a373f // indirect
 	github.com/filecoin-project/specs-actors v0.8.1-0.20200720115956-cd051eabf328
 	github.com/ipfs/go-block-format v0.0.2
 	github.com/ipfs/go-cid v0.0.7
-	github.com/ipfs/go-datastore v0.4.4
+	github.com/ipfs/go-datastore v0.4.5
 	github.com/ipfs/go-ipfs-blockstore v1.0.0
+	github.com/ipfs/go-ipld-format v0.0.2
 	github.com/ipfs/go-log/v2 v2.1.1
-	github.com/libp2p/go-libp2p v0.10.2
-	github.com/libp2p/go-libp2p-core v0.6.1
-	github.com/libp2p/go-libp2p-pubsub v0.3.3
+	github.com/ipfs/go-merkledag v0.3.2
+	github.com/ipld/go-car v0.1.0
+	github.com/libp2p/go-libp2p v0.12.0
+	github.com/libp2p/go-libp2p-core v0.7.0
+	github.com/libp2p/go-libp2p-kad-dht v0.11.1
+	github.com/libp2p/go-libp2p-pubsub v0.4.0
 	github.com/libp2p/go-sockaddr v0.1.0 // indirect
-	github.com/multiformats/go-multiaddr v0.2.2
-	github.com/onsi/ginkgo v1.12.1 // indirect
+	github.com/multiformats/go-multiaddr v0.3.1
 	github.com/stretchr/testify v1.6.1
 	github.com/urfave/cli v1.22.4
-	github.com/whyrusleeping/cbor-gen v0.0.0-20200723182808-cb5de1c427f5 // indirect
+	github.com/whyrusleeping/cbor-gen v0.0.0-20200723182808-cb5de1c427f5
 	golang.org/x/crypto v0.0.0-20200510223506-06a226fb4e37 // indirect
 	golang.org/x/lint v0.0.0-20191125180803-fdd1cda4f05f // indirect
 	golang.org/x/sys v0.0.0-20200509044756-6aff5f38e54f // indirect
 	golang.org/x/tools v0.0.0-20200108195415-316d2f248479 // indirect
-	google.golang.org/protobuf v1.23.0 // indirect
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543
+	gopkg.in/yaml.v2 v2.2.4
 )
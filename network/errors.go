@@ -9,3 +9,27 @@ import (
 
 // ErrNilHost is returned when trying to instantiate a network with a nil host
 var ErrNilHost = errors.New("host is nil")
+
+// ErrUnknownTopic is returned when trying to publish to a topic the network has not joined
+var ErrUnknownTopic = errors.New("unknown topic")
+
+// ErrAlreadyStarted is returned when starting a network that has already been started
+var ErrAlreadyStarted = errors.New("network already started")
+
+// ErrStopped is returned when starting a network that has been stopped
+var ErrStopped = errors.New("network stopped")
+
+// ErrMessageTooLarge is returned when validating a gossiped message larger than the size limit
+var ErrMessageTooLarge = errors.New("message too large")
+
+// ErrNoQueryID is returned when validating a gossiped query without an ID
+var ErrNoQueryID = errors.New("query has no ID")
+
+// ErrNoPayloadCID is returned when validating a gossiped query without a payload CID
+var ErrNoPayloadCID = errors.New("query has no payload CID")
+
+// ErrNoClientAddrs is returned when validating a gossiped query without client addrs to respond to
+var ErrNoClientAddrs = errors.New("query has no client addrs")
+
+// ErrTooManyClientAddrs is returned when validating a gossiped query with more than MaxClientAddrs client addrs
+var ErrTooManyClientAddrs = errors.New("query has too many client addrs")
@@ -6,10 +6,13 @@ package network
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
 	logging "github.com/ipfs/go-log/v2"
 	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
 	peer "github.com/libp2p/go-libp2p-core/peer"
@@ -21,35 +24,71 @@ var log = logging.Logger("network")
 // Host wraps a libp2p host. It contains the current pubsub state.
 // Host implements the Network interface
 type Network struct {
-	host         host.Host
-	pubsub       *pubsub.PubSub
-	topic        *pubsub.Topic
-	subscription *pubsub.Subscription
-	msgs         chan []byte
+	delivered uint64 // number of messages delivered to msgs, accessed atomically
+	dropped   uint64 // number of messages dropped because msgs was full, accessed atomically
+	rejected  uint64 // number of messages rejected by the topic validators, accessed atomically
+
+	host           host.Host
+	pubsub         *pubsub.PubSub
+	cancelPubsub   context.CancelFunc
+	topics         map[core.ProtocolID]*pubsub.Topic
+	subscriptions  []*pubsub.Subscription
+	msgs           chan *shared.Message
+	overflow       OverflowPolicy
+	maxMessageSize int
+
+	scoresLock sync.RWMutex
+	scores     map[peer.ID]float64 // latest peer scores, updated by the pubsub score inspector
+
+	lock    sync.RWMutex
+	cancel  context.CancelFunc // cancels the context of the message handlers, nil if not started
+	stopped bool
+	wg      sync.WaitGroup
 }
 
-// NewNetwork returns a Network
-func NewNetwork(h host.Host) (*Network, error) {
+// NewNetwork returns a Network using the given host, configured with the given options
+func NewNetwork(h host.Host, opts ...Option) (*Network, error) {
 	if h == nil {
 		return nil, ErrNilHost
 	}
 
-	ctx := context.Background()
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	n := &Network{
+		host:           h,
+		topics:         make(map[core.ProtocolID]*pubsub.Topic),
+		msgs:           make(chan *shared.Message, o.bufferSize),
+		overflow:       o.overflow,
+		maxMessageSize: o.maxMessageSize,
+		scores:         make(map[peer.ID]float64),
+	}
 
 	psOpts := []pubsub.Option{
 		pubsub.WithFloodPublish(true),
 	}
 
+	if o.scoreParams != nil {
+		psOpts = append(psOpts,
+			pubsub.WithPeerScore(o.scoreParams, o.scoreThresholds),
+			pubsub.WithPeerScoreInspect(pubsub.PeerScoreInspectFn(n.inspectScores), o.scoreInspectPeriod),
+		)
+	}
+
+	// pubsub runs until the network is stopped
+	ctx, cancel := context.WithCancel(context.Background())
+
 	ps, err := pubsub.NewGossipSub(ctx, h, psOpts...)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
-	return &Network{
-		host:   h,
-		pubsub: ps,
-		msgs:   make(chan []byte),
-	}, nil
+	n.pubsub = ps
+	n.cancelPubsub = cancel
+	return n, nil
 }
 
 // AddrInfo returns the host's AddrInfo
@@ -75,35 +114,167 @@ func (n *Network) MultiAddrs() []string {
 	return multiaddrs
 }
 
+// Host returns the underlying libp2p host, eg. to run a DHT alongside pubsub
+func (n *Network) Host() host.Host {
+	return n.host
+}
+
 func (n *Network) PeerID() peer.ID {
 	return n.host.ID()
 }
 
+// PrivKey returns the host's private key, used to sign queries and responses
+func (n *Network) PrivKey() crypto.PrivKey {
+	return n.host.Peerstore().PrivKey(n.host.ID())
+}
+
 func (n *Network) Peers() []peer.ID {
 	return n.host.Peerstore().Peers()
 }
 
-// Start begins pubsub by subscribing to the markets topic
-func (n *Network) Start() error {
-	var err error
-	n.topic, err = n.pubsub.Join(string(shared.RetrievalProtocolID))
-	if err != nil {
-		return err
+// PeerAddrs returns the known multiaddrs of the given peer
+func (n *Network) PeerAddrs(p peer.ID) []string {
+	addrs := []string{}
+	for _, addr := range n.host.Peerstore().Addrs(p) {
+		addrs = append(addrs, fmt.Sprintf("%s/p2p/%s", addr, p))
 	}
+	return addrs
+}
 
-	n.subscription, err = n.topic.Subscribe()
-	if err != nil {
-		return err
+// ConnectedPeers returns the peers the host currently has open connections to
+func (n *Network) ConnectedPeers() []peer.ID {
+	return n.host.Network().Peers()
+}
+
+// Start begins pubsub by subscribing to the markets topic of each supported protocol version.
+// Messages are received until Stop is called or the context is done. If Start fails, anything it started is
+// cancelled before the error is returned.
+func (n *Network) Start(ctx context.Context) (err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.stopped {
+		return ErrStopped
+	}
+
+	if n.cancel != nil {
+		return ErrAlreadyStarted
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	n.cancel = cancel
+
+	// undo whatever was started if a later version fails, so Start can be retried
+	var validated []core.ProtocolID
+	defer func() {
+		if err != nil {
+			n.abortStart(validated)
+		}
+	}()
+
+	for _, v := range shared.Versions {
+		// invalid queries are rejected before they are delivered or forwarded
+		err = n.pubsub.RegisterTopicValidator(string(v.Topic), n.validator(v))
+		if err != nil {
+			return err
+		}
+		validated = append(validated, v.Topic)
+
+		var topic *pubsub.Topic
+		topic, err = n.pubsub.Join(string(v.Topic))
+		if err != nil {
+			return err
+		}
+		n.topics[v.Topic] = topic
+
+		var sub *pubsub.Subscription
+		sub, err = topic.Subscribe()
+		if err != nil {
+			return err
+		}
+		n.subscriptions = append(n.subscriptions, sub)
+
+		n.wg.Add(1)
+		go n.handleMessages(ctx, v.Topic, sub)
 	}
 
-	go n.handleMessages()
 	return nil
 }
 
-// Stop cancels all subscriptions
-func (n *Network) Stop() error {
-	n.subscription.Cancel()
-	return n.topic.Close()
+// abortStart cancels the subscriptions and message handlers started by a failed call to Start,
+// then closes its topics and unregisters its validators. It must be called with the lock held.
+func (n *Network) abortStart(validated []core.ProtocolID) {
+	for _, sub := range n.subscriptions {
+		sub.Cancel()
+	}
+	n.subscriptions = nil
+
+	n.cancel()
+	n.cancel = nil
+	n.wg.Wait()
+
+	for id, topic := range n.topics {
+		if err := topic.Close(); err != nil {
+			log.Warn("failed to close topic ", id, "; error: ", err)
+		}
+		delete(n.topics, id)
+	}
+
+	for _, id := range validated {
+		if err := n.pubsub.UnregisterTopicValidator(string(id)); err != nil {
+			log.Warn("failed to unregister validator for topic ", id, "; error: ", err)
+		}
+	}
+}
+
+// Stop cancels all subscriptions, waits for the message handlers to return, then closes the pubsub topics
+// and the libp2p host. Messages that haven't been read from Messages are dropped.
+// The network can't be restarted once stopped.
+func (n *Network) Stop(ctx context.Context) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.stopped {
+		return nil
+	}
+	n.stopped = true
+
+	for _, sub := range n.subscriptions {
+		sub.Cancel()
+	}
+	n.subscriptions = nil
+
+	if n.cancel != nil {
+		n.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn("timed out waiting for message handlers to return")
+	}
+
+	for id, topic := range n.topics {
+		err := topic.Close()
+		if err != nil {
+			return err
+		}
+		delete(n.topics, id)
+
+		err = n.pubsub.UnregisterTopicValidator(string(id))
+		if err != nil {
+			return err
+		}
+	}
+
+	n.cancelPubsub()
+	return n.host.Close()
 }
 
 // RegisterStreamHandler registers a handler and protocol ID on the libp2p host
@@ -112,8 +283,7 @@ func (n *Network) RegisterStreamHandler(id core.ProtocolID, handler network.Stre
 }
 
 // Connect connects directly to a peer
-func (n *Network) Connect(p peer.AddrInfo) error {
-	ctx := context.Background()
+func (n *Network) Connect(ctx context.Context, p peer.AddrInfo) error {
 	return n.host.Connect(ctx, p)
 }
 
@@ -125,38 +295,116 @@ func (n *Network) Send(ctx context.Context, protocol core.ProtocolID, p peer.ID,
 		return err
 	}
 
-	data = append(data, '\n')
 	_, err = s.Write(data)
-	return err
+	if err != nil {
+		_ = s.Reset()
+		return err
+	}
+
+	return s.Close()
 }
 
-// Publish publishes some data
-func (n *Network) Publish(ctx context.Context, data []byte) error {
-	return n.topic.Publish(ctx, data)
+// NewStream opens a new stream to the given peer, negotiating the first of the given
+// protocols that the peer supports
+func (n *Network) NewStream(ctx context.Context, p peer.ID, protocols ...core.ProtocolID) (network.Stream, error) {
+	return n.host.NewStream(ctx, p, protocols...)
+}
+
+// Publish publishes some data on the topic with the given protocol ID
+func (n *Network) Publish(ctx context.Context, topic core.ProtocolID, data []byte) error {
+	n.lock.RLock()
+	t, has := n.topics[topic]
+	n.lock.RUnlock()
+	if !has {
+		return ErrUnknownTopic
+	}
+	return t.Publish(ctx, data)
 }
 
-// Messages returns the receive-only pubsub message channel
-func (n *Network) Messages() <-chan []byte {
+// Messages returns the receive-only pubsub message channel. Received messages are buffered until they are
+// read, and handled according to the network's overflow policy once the buffer is full.
+func (n *Network) Messages() <-chan *shared.Message {
 	return n.msgs
 }
 
-// handleMessages puts each message received through the host's subscription into the host's msgs channel
-func (n *Network) handleMessages() {
+// Delivered returns the number of received messages that have been put in the message buffer
+func (n *Network) Delivered() uint64 {
+	return atomic.LoadUint64(&n.delivered)
+}
+
+// Dropped returns the number of received messages that have been dropped because the message buffer was full
+func (n *Network) Dropped() uint64 {
+	return atomic.LoadUint64(&n.dropped)
+}
+
+// Rejected returns the number of received messages that have been rejected because they aren't valid queries
+func (n *Network) Rejected() uint64 {
+	return atomic.LoadUint64(&n.rejected)
+}
+
+// Buffered returns the number of messages in the message buffer
+func (n *Network) Buffered() int {
+	return len(n.msgs)
+}
+
+// handleMessages delivers each message received through the subscription to the msgs channel,
+// until the subscription is cancelled or the context is done
+func (n *Network) handleMessages(ctx context.Context, topic core.ProtocolID, sub *pubsub.Subscription) {
+	defer n.wg.Done()
+
 	for {
-		msg, err := n.next()
+		msg, err := sub.Next(ctx)
 		if err != nil {
-			log.Warn("failed to get next message from subscription")
-			continue
+			log.Debug("stopped receiving messages on topic ", topic, "; error: ", err)
+			return
+		}
+
+		n.deliver(ctx, &shared.Message{
+			Topic: topic,
+			From:  msg.GetFrom(),
+			Data:  msg.Data,
+		})
+	}
+}
+
+// deliver puts the message in the msgs channel according to the network's overflow policy
+func (n *Network) deliver(ctx context.Context, msg *shared.Message) {
+	switch n.overflow {
+	case OverflowBlock:
+		select {
+		case n.msgs <- msg:
+			atomic.AddUint64(&n.delivered, 1)
+		case <-ctx.Done():
 		}
+	case OverflowDropOldest:
+		// without a buffer there's no older message to drop, so the new one is dropped instead
+		for cap(n.msgs) > 0 {
+			select {
+			case n.msgs <- msg:
+				atomic.AddUint64(&n.delivered, 1)
+				return
+			default:
+			}
 
-		if msg != nil {
-			n.msgs <- msg.Data
+			// make room by dropping the oldest message, unless it has just been read
+			select {
+			case oldest := <-n.msgs:
+				n.drop(oldest)
+			default:
+			}
+		}
+		fallthrough
+	case OverflowDropNewest:
+		select {
+		case n.msgs <- msg:
+			atomic.AddUint64(&n.delivered, 1)
+		default:
+			n.drop(msg)
 		}
 	}
 }
 
-// next returns the next message in the subscription
-func (n *Network) next() (*pubsub.Message, error) {
-	ctx := context.Background()
-	return n.subscription.Next(ctx)
+func (n *Network) drop(msg *shared.Message) {
+	atomic.AddUint64(&n.dropped, 1)
+	log.Debug("message buffer is full, dropping message from ", msg.From, " on topic ", msg.Topic)
 }
@@ -6,6 +6,7 @@ package network
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
 	libp2p "github.com/libp2p/go-libp2p"
@@ -26,10 +27,97 @@ func TestStartAndStop(t *testing.T) {
 	n, err := NewNetwork(h)
 	require.NoError(t, err)
 
-	err = n.Start()
+	err = n.Start(context.Background())
 	require.NoError(t, err)
 
-	err = n.Stop()
+	err = n.Stop(context.Background())
+	require.NoError(t, err)
+}
+
+func TestStartAndStop_Lifecycle(t *testing.T) {
+	h := newTestHost(t)
+	n, err := NewNetwork(h)
+	require.NoError(t, err)
+
+	err = n.Start(context.Background())
+	require.NoError(t, err)
+
+	err = n.Start(context.Background())
+	require.Equal(t, ErrAlreadyStarted, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// the message handlers return, and the host is closed
+	err = n.Stop(ctx)
+	require.NoError(t, err)
+	require.NoError(t, ctx.Err())
+	require.Empty(t, h.Network().ListenAddresses())
+	require.Empty(t, n.pubsub.GetTopics())
+
+	err = n.Stop(context.Background())
+	require.NoError(t, err)
+
+	err = n.Start(context.Background())
+	require.Equal(t, ErrStopped, err)
+}
+
+func TestStart_ContextDone(t *testing.T) {
+	h := newTestHost(t)
+	n, err := NewNetwork(h)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = n.Start(ctx)
+	require.NoError(t, err)
+
+	// the message handlers return once the context is done
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("message handlers did not return")
+	}
+
+	err = n.Stop(context.Background())
+	require.NoError(t, err)
+}
+
+func TestStart_Failure(t *testing.T) {
+	h := newTestHost(t)
+	n, err := NewNetwork(h)
+	require.NoError(t, err)
+
+	// joining the last version's topic beforehand makes Start fail after the earlier versions have started
+	last := shared.Versions[len(shared.Versions)-1].Topic
+	joined, err := n.pubsub.Join(string(last))
+	require.NoError(t, err)
+
+	err = n.Start(context.Background())
+	require.Error(t, err)
+
+	// the subscriptions, handlers and topics that were started are cleaned up
+	require.Empty(t, n.subscriptions)
+	require.Empty(t, n.topics)
+	require.Nil(t, n.cancel)
+	require.Empty(t, n.pubsub.GetTopics())
+
+	err = n.Publish(context.Background(), shared.Versions[0].Topic, []byte("query"))
+	require.Equal(t, ErrUnknownTopic, err)
+
+	// once the conflicting topic is closed, the network can be started
+	require.NoError(t, joined.Close())
+	err = n.Start(context.Background())
+	require.NoError(t, err)
+
+	err = n.Stop(context.Background())
 	require.NoError(t, err)
 }
 
@@ -38,15 +126,129 @@ func TestPubSubTopics(t *testing.T) {
 	n, err := NewNetwork(h)
 	require.NoError(t, err)
 
-	err = n.Start()
+	err = n.Start(context.Background())
 	require.NoError(t, err)
 
 	defer func() {
-		err = n.Stop()
+		err = n.Stop(context.Background())
 		require.NoError(t, err)
 	}()
 
 	topics := n.pubsub.GetTopics()
-	require.Equal(t, 1, len(topics))
-	require.Equal(t, string(shared.RetrievalProtocolID), topics[0])
+	expected := []string{}
+	for _, v := range shared.Versions {
+		expected = append(expected, string(v.Topic))
+	}
+	require.ElementsMatch(t, expected, topics)
+}
+
+func newTestMessage(data string) *shared.Message {
+	return &shared.Message{
+		Topic: shared.RetrievalProtocolID,
+		Data:  []byte(data),
+	}
+}
+
+func readTestMessages(n *Network) []string {
+	var data []string
+	for n.Buffered() > 0 {
+		data = append(data, string((<-n.msgs).Data))
+	}
+	return data
+}
+
+func TestDeliver(t *testing.T) {
+	testCases := []struct {
+		policy   OverflowPolicy
+		expected []string
+	}{
+		{OverflowDropOldest, []string{"c", "d"}},
+		{OverflowDropNewest, []string{"a", "b"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			n := &Network{
+				msgs:     make(chan *shared.Message, 2),
+				overflow: tc.policy,
+			}
+
+			for _, data := range []string{"a", "b", "c", "d"} {
+				n.deliver(context.Background(), newTestMessage(data))
+			}
+
+			require.Equal(t, 2, n.Buffered())
+			require.Equal(t, uint64(2), n.Dropped())
+			require.Equal(t, tc.expected, readTestMessages(n))
+		})
+	}
+}
+
+func TestDeliver_Unbuffered(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowDropOldest, OverflowDropNewest} {
+		n := &Network{
+			msgs:     make(chan *shared.Message),
+			overflow: policy,
+		}
+
+		// there's no reader, so the message is dropped
+		n.deliver(context.Background(), newTestMessage("a"))
+		require.Equal(t, uint64(0), n.Delivered())
+		require.Equal(t, uint64(1), n.Dropped())
+	}
+}
+
+func TestDeliver_Block(t *testing.T) {
+	n := &Network{
+		msgs:     make(chan *shared.Message, 1),
+		overflow: OverflowBlock,
+	}
+
+	n.deliver(context.Background(), newTestMessage("a"))
+
+	// delivery waits for room in the buffer, or for the context to be done
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		n.deliver(ctx, newTestMessage("b"))
+		n.deliver(ctx, newTestMessage("c"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("delivery did not block")
+	case <-time.After(time.Millisecond * 10):
+	}
+
+	require.Equal(t, "a", string((<-n.msgs).Data))
+	require.Eventually(t, func() bool {
+		return n.Delivered() == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	require.Equal(t, uint64(2), n.Delivered())
+	require.Equal(t, uint64(0), n.Dropped())
+	require.Equal(t, []string{"b"}, readTestMessages(n))
+}
+
+func TestNewNetwork_Options(t *testing.T) {
+	h := newTestHost(t)
+	n, err := NewNetwork(h, WithBufferSize(4), WithOverflowPolicy(OverflowBlock))
+	require.NoError(t, err)
+	require.Equal(t, 4, cap(n.msgs))
+	require.Equal(t, OverflowBlock, n.overflow)
+	require.NoError(t, n.Stop(context.Background()))
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowDropOldest, OverflowDropNewest, OverflowBlock} {
+		parsed, err := ParseOverflowPolicy(policy.String())
+		require.NoError(t, err)
+		require.Equal(t, policy, parsed)
+	}
+
+	_, err := ParseOverflowPolicy("drop-random")
+	require.Error(t, err)
 }
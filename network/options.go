@@ -0,0 +1,125 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package network
+
+import (
+	"fmt"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// DefaultBufferSize is the default number of received messages buffered until they are read from Messages
+var DefaultBufferSize = 128
+
+// OverflowPolicy determines what happens to a received message when the message buffer is full
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest drops the oldest buffered message to make room for the new one
+	OverflowDropOldest OverflowPolicy = iota
+
+	// OverflowDropNewest drops the new message
+	OverflowDropNewest
+
+	// OverflowBlock waits for room in the buffer. This blocks delivery from pubsub, which may then drop messages itself.
+	OverflowBlock
+)
+
+// String returns the name of the policy
+func (o OverflowPolicy) String() string {
+	switch o {
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowBlock:
+		return "block"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(o))
+	}
+}
+
+// ParseOverflowPolicy returns the policy with the given name
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	for _, o := range []OverflowPolicy{OverflowDropOldest, OverflowDropNewest, OverflowBlock} {
+		if o.String() == name {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overflow policy %q, must be drop-oldest, drop-newest or block", name)
+}
+
+// options are the configurable settings of a Network
+type options struct {
+	bufferSize     int
+	overflow       OverflowPolicy
+	maxMessageSize int
+
+	scoreParams        *pubsub.PeerScoreParams // nil disables peer scoring
+	scoreThresholds    *pubsub.PeerScoreThresholds
+	scoreInspectPeriod time.Duration
+}
+
+func defaultOptions() *options {
+	return &options{
+		bufferSize:     DefaultBufferSize,
+		overflow:       OverflowDropOldest,
+		maxMessageSize: DefaultMaxMessageSize,
+
+		scoreParams:        DefaultPeerScoreParams(),
+		scoreThresholds:    DefaultPeerScoreThresholds(),
+		scoreInspectPeriod: DefaultPeerScoreInspectPeriod,
+	}
+}
+
+// Option configures a Network
+type Option func(*options)
+
+// WithBufferSize sets the number of received messages buffered until they are read from Messages
+func WithBufferSize(size int) Option {
+	return func(o *options) {
+		if size < 0 {
+			size = 0
+		}
+		o.bufferSize = size
+	}
+}
+
+// WithOverflowPolicy sets what happens to a received message when the message buffer is full
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(o *options) {
+		o.overflow = policy
+	}
+}
+
+// WithMaxMessageSize sets the size limit of gossiped queries, in bytes. Larger messages are rejected
+// by the topic validator. A size of 0 or less disables the limit.
+func WithMaxMessageSize(size int) Option {
+	return func(o *options) {
+		o.maxMessageSize = size
+	}
+}
+
+// WithPeerScore sets the gossipsub peer score parameters and thresholds. Nil params disable peer scoring,
+// and nil thresholds leave the current thresholds unchanged.
+func WithPeerScore(params *pubsub.PeerScoreParams, thresholds *pubsub.PeerScoreThresholds) Option {
+	return func(o *options) {
+		o.scoreParams = params
+		if thresholds != nil {
+			o.scoreThresholds = thresholds
+		}
+	}
+}
+
+// WithPeerScoreThresholds sets the gossipsub peer score thresholds, keeping the current score parameters.
+// Nil thresholds reset them to DefaultPeerScoreThresholds.
+func WithPeerScoreThresholds(thresholds *pubsub.PeerScoreThresholds) Option {
+	return func(o *options) {
+		if thresholds == nil {
+			thresholds = DefaultPeerScoreThresholds()
+		}
+		o.scoreThresholds = thresholds
+	}
+}
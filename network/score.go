@@ -0,0 +1,100 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package network
+
+import (
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// DefaultPeerScoreInspectPeriod is how often the peer scores returned by Network.PeerScores are refreshed
+var DefaultPeerScoreInspectPeriod = 10 * time.Second
+
+// DefaultPeerScoreThresholds returns the default gossipsub peer score thresholds.
+// Peers whose score drops below the graylist threshold, ie. after around 5 recent invalid queries,
+// are ignored altogether.
+func DefaultPeerScoreThresholds() *pubsub.PeerScoreThresholds {
+	return &pubsub.PeerScoreThresholds{
+		GossipThreshold:             -500,
+		PublishThreshold:            -1000,
+		GraylistThreshold:           -2500,
+		AcceptPXThreshold:           1000,
+		OpportunisticGraftThreshold: 3.5,
+	}
+}
+
+// DefaultPeerScoreParams returns the default gossipsub peer score parameters, which score peers on the
+// topic of each supported protocol version with DefaultTopicScoreParams.
+// More than 5 peers connecting from the same IP are penalised, unless it's a loopback address.
+func DefaultPeerScoreParams() *pubsub.PeerScoreParams {
+	topics := make(map[string]*pubsub.TopicScoreParams)
+	for _, v := range shared.Versions {
+		topics[string(v.Topic)] = DefaultTopicScoreParams()
+	}
+
+	return &pubsub.PeerScoreParams{
+		Topics:        topics,
+		TopicScoreCap: 10,
+
+		AppSpecificScore:  func(peer.ID) float64 { return 0 },
+		AppSpecificWeight: 1,
+
+		IPColocationFactorWeight:    -100,
+		IPColocationFactorThreshold: 5,
+		IPColocationFactorWhitelist: map[string]struct{}{
+			"127.0.0.1": {},
+			"::1":       {},
+		},
+
+		BehaviourPenaltyWeight: -10,
+		BehaviourPenaltyDecay:  pubsub.ScoreParameterDecay(time.Hour),
+
+		DecayInterval: pubsub.DefaultDecayInterval,
+		DecayToZero:   pubsub.DefaultDecayToZero,
+		RetainScore:   6 * time.Hour,
+	}
+}
+
+// DefaultTopicScoreParams returns the default score parameters of a query topic. Peers are rewarded for time
+// in the mesh and for being the first to deliver a query, and penalised for each query rejected by the topic
+// validator. Queries are sporadic, so peers aren't penalised for a lack of mesh deliveries.
+func DefaultTopicScoreParams() *pubsub.TopicScoreParams {
+	return &pubsub.TopicScoreParams{
+		TopicWeight: 1,
+
+		TimeInMeshWeight:  0.01,
+		TimeInMeshQuantum: time.Second,
+		TimeInMeshCap:     300,
+
+		FirstMessageDeliveriesWeight: 1,
+		FirstMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(10 * time.Minute),
+		FirstMessageDeliveriesCap:    10,
+
+		InvalidMessageDeliveriesWeight: -100,
+		InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+	}
+}
+
+// PeerScores returns the gossipsub score of each known peer, as of the last inspection.
+// It is empty if peer scoring is disabled.
+func (n *Network) PeerScores() map[peer.ID]float64 {
+	n.scoresLock.RLock()
+	defer n.scoresLock.RUnlock()
+
+	scores := make(map[peer.ID]float64, len(n.scores))
+	for p, score := range n.scores {
+		scores[p] = score
+	}
+	return scores
+}
+
+// inspectScores is the pubsub peer score inspector, which records the latest scores
+func (n *Network) inspectScores(scores map[peer.ID]float64) {
+	n.scoresLock.Lock()
+	defer n.scoresLock.Unlock()
+	n.scores = scores
+}
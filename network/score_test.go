@@ -0,0 +1,82 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/stretchr/testify/require"
+)
+
+func withScoreInspectPeriod(period time.Duration) Option {
+	return func(o *options) {
+		o.scoreInspectPeriod = period
+	}
+}
+
+func TestNewNetwork_PeerScore(t *testing.T) {
+	// the defaults are accepted by pubsub
+	n, err := NewNetwork(newTestHost(t))
+	require.NoError(t, err)
+	require.NoError(t, n.Stop(context.Background()))
+
+	thresholds := DefaultPeerScoreThresholds()
+	thresholds.GraylistThreshold = -5000
+	n, err = NewNetwork(newTestHost(t), WithPeerScoreThresholds(thresholds))
+	require.NoError(t, err)
+	require.NoError(t, n.Stop(context.Background()))
+
+	// the graylist threshold must be below the publish threshold
+	thresholds.GraylistThreshold = 0
+	_, err = NewNetwork(newTestHost(t), WithPeerScoreThresholds(thresholds))
+	require.Error(t, err)
+
+	params := DefaultPeerScoreParams()
+	params.IPColocationFactorWeight = 1
+	_, err = NewNetwork(newTestHost(t), WithPeerScore(params, nil))
+	require.Error(t, err)
+
+	// without peer scoring, there are no scores
+	n, err = NewNetwork(newTestHost(t), WithPeerScore(nil, nil))
+	require.NoError(t, err)
+	require.Empty(t, n.PeerScores())
+	require.NoError(t, n.Stop(context.Background()))
+}
+
+func TestPeerScore_InvalidMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n, err := NewNetwork(newTestHost(t), withScoreInspectPeriod(100*time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, n.Start(ctx))
+	defer func() {
+		require.NoError(t, n.Stop(ctx))
+	}()
+
+	// the spammer doesn't validate its own messages
+	h := newTestHost(t)
+	spammer, err := pubsub.NewGossipSub(ctx, h)
+	require.NoError(t, err)
+	topic, err := spammer.Join(string(shared.CBORVersion.Topic))
+	require.NoError(t, err)
+
+	require.NoError(t, h.Connect(ctx, n.AddrInfo()))
+	require.Eventually(t, func() bool {
+		return len(topic.ListPeers()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, topic.Publish(ctx, []byte("junk")))
+	}
+
+	require.Eventually(t, func() bool {
+		return n.Rejected() == 3 && n.PeerScores()[h.ID()] < 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, uint64(0), n.Delivered())
+}
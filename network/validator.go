@@ -0,0 +1,79 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package network
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// DefaultMaxMessageSize is the default size limit of a gossiped query, in bytes
+var DefaultMaxMessageSize = 4 << 10
+
+// MaxClientAddrs is the most multiaddrs a gossiped query may list for its client
+var MaxClientAddrs = 16
+
+// validator returns the pubsub validator of the topic of the given version. Messages that aren't valid
+// queries are rejected, so they aren't forwarded to the rest of the mesh and count against the sender's score.
+// Queries without an ID on the 0.0.1 JSON topic, which older clients may send, are ignored instead, so
+// peers that still forward them aren't penalized.
+func (n *Network) validator(v shared.Version) pubsub.ValidatorEx {
+	return func(_ context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		err := validateQuery(v, msg.Data, n.maxMessageSize)
+		if err == ErrNoQueryID && v.Topic == shared.JSONVersion.Topic {
+			log.Debug("ignoring message without query id from ", from, " on topic ", v.Topic)
+			return pubsub.ValidationIgnore
+		}
+		if err != nil {
+			atomic.AddUint64(&n.rejected, 1)
+			log.Debug("rejecting message from ", from, " on topic ", v.Topic, "; error: ", err)
+			return pubsub.ValidationReject
+		}
+		return pubsub.ValidationAccept
+	}
+}
+
+// validateQuery checks that the data is a query encoded with the version's codec, no larger than maxSize,
+// with an ID, a payload CID and parseable client addrs, and a valid signature if it is signed
+func validateQuery(v shared.Version, data []byte, maxSize int) error {
+	if maxSize > 0 && len(data) > maxSize {
+		return ErrMessageTooLarge
+	}
+
+	query, err := shared.DecodeQuery(v.Codec, data)
+	if err != nil {
+		return err
+	}
+
+	if query.ID == "" {
+		return ErrNoQueryID
+	}
+
+	if !query.Params.PayloadCID.Defined() {
+		return ErrNoPayloadCID
+	}
+
+	if len(query.ClientAddrs) == 0 {
+		return ErrNoClientAddrs
+	}
+
+	if len(query.ClientAddrs) > MaxClientAddrs {
+		return ErrTooManyClientAddrs
+	}
+
+	_, err = shared.StringsToAddrInfos(query.ClientAddrs)
+	if err != nil {
+		return err
+	}
+
+	if query.Signed() {
+		return query.Verify()
+	}
+
+	return nil
+}
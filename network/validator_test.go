@@ -0,0 +1,181 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/stretchr/testify/require"
+)
+
+var testCid, _ = cid.Decode("bafybeierhgbz4zp2x2u67urqrgfnrnlukciupzenpqpipiz5nwtq7uxpx4")
+
+func newTestQuery(t *testing.T) (*shared.Query, crypto.PrivKey) {
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(key)
+	require.NoError(t, err)
+
+	return &shared.Query{
+		ID:          shared.NewQueryID(),
+		Params:      shared.Params{PayloadCID: testCid},
+		ClientAddrs: []string{"/ip4/1.2.3.4/tcp/5678/p2p/" + id.String()},
+	}, key
+}
+
+func TestValidateQuery(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(q *shared.Query, key crypto.PrivKey)
+		err    error
+	}{
+		{"valid", func(q *shared.Query, key crypto.PrivKey) {}, nil},
+		{"signed", func(q *shared.Query, key crypto.PrivKey) {
+			require.NoError(t, q.Sign(key))
+		}, nil},
+		{"no id", func(q *shared.Query, key crypto.PrivKey) {
+			q.ID = ""
+		}, ErrNoQueryID},
+		{"no client addrs", func(q *shared.Query, key crypto.PrivKey) {
+			q.ClientAddrs = nil
+		}, ErrNoClientAddrs},
+		{"too many client addrs", func(q *shared.Query, key crypto.PrivKey) {
+			for len(q.ClientAddrs) <= MaxClientAddrs {
+				q.ClientAddrs = append(q.ClientAddrs, q.ClientAddrs[0])
+			}
+		}, ErrTooManyClientAddrs},
+		{"invalid signature", func(q *shared.Query, key crypto.PrivKey) {
+			require.NoError(t, q.Sign(key))
+			q.ID = shared.NewQueryID()
+		}, shared.ErrInvalidSignature},
+	}
+
+	for _, v := range shared.Versions {
+		for _, tc := range testCases {
+			t.Run(string(v.Topic)+"/"+tc.name, func(t *testing.T) {
+				q, key := newTestQuery(t)
+				tc.modify(q, key)
+
+				bz, err := shared.EncodeQuery(v.Codec, q)
+				require.NoError(t, err)
+				require.Equal(t, tc.err, validateQuery(v, bz, DefaultMaxMessageSize))
+			})
+		}
+	}
+}
+
+func TestValidateQuery_Malformed(t *testing.T) {
+	for _, v := range shared.Versions {
+		q, _ := newTestQuery(t)
+		bz, err := shared.EncodeQuery(v.Codec, q)
+		require.NoError(t, err)
+
+		// over the size limit
+		require.Equal(t, ErrMessageTooLarge, validateQuery(v, bz, len(bz)-1))
+		require.NoError(t, validateQuery(v, bz, 0))
+
+		// not a query
+		require.Error(t, validateQuery(v, []byte("junk"), DefaultMaxMessageSize))
+
+		// not a multiaddr
+		q.ClientAddrs = []string{"1.2.3.4:5678"}
+		bz, err = shared.EncodeQuery(v.Codec, q)
+		require.NoError(t, err)
+		require.Error(t, validateQuery(v, bz, DefaultMaxMessageSize))
+
+		// without a peer ID the client can't be dialled
+		q.ClientAddrs = []string{"/ip4/1.2.3.4/tcp/5678"}
+		bz, err = shared.EncodeQuery(v.Codec, q)
+		require.NoError(t, err)
+		require.Error(t, validateQuery(v, bz, DefaultMaxMessageSize))
+	}
+
+	// an undefined cid can only be encoded as json
+	q, _ := newTestQuery(t)
+	q.Params.PayloadCID = cid.Undef
+	bz, err := shared.EncodeQuery(shared.JSONVersion.Codec, q)
+	require.NoError(t, err)
+	require.Equal(t, ErrNoPayloadCID, validateQuery(shared.JSONVersion, bz, DefaultMaxMessageSize))
+}
+
+func TestValidator_IgnoresLegacyQueriesWithoutID(t *testing.T) {
+	n, err := NewNetwork(newTestHost(t))
+	require.NoError(t, err)
+
+	q, _ := newTestQuery(t)
+	q.ID = ""
+
+	// queries without an ID are only tolerated on the 0.0.1 topic
+	for _, tc := range []struct {
+		version  shared.Version
+		expected pubsub.ValidationResult
+	}{
+		{shared.JSONVersion, pubsub.ValidationIgnore},
+		{shared.CBORVersion, pubsub.ValidationReject},
+	} {
+		data, err := shared.EncodeQuery(tc.version.Codec, q)
+		require.NoError(t, err)
+
+		msg := &pubsub.Message{Message: &pb.Message{Data: data}}
+		require.Equal(t, tc.expected, n.validator(tc.version)(context.Background(), "peer", msg), tc.version.Topic)
+	}
+	require.Equal(t, uint64(1), n.Rejected())
+}
+
+func TestValidator_RejectsInvalidQueries(t *testing.T) {
+	ctx := context.Background()
+
+	a, err := NewNetwork(newTestHost(t))
+	require.NoError(t, err)
+	b, err := NewNetwork(newTestHost(t))
+	require.NoError(t, err)
+
+	require.NoError(t, a.Start(ctx))
+	require.NoError(t, b.Start(ctx))
+	defer func() {
+		require.NoError(t, a.Stop(ctx))
+		require.NoError(t, b.Stop(ctx))
+	}()
+
+	require.NoError(t, a.Connect(ctx, b.AddrInfo()))
+
+	// wait for the peers to join each other's topic
+	require.Eventually(t, func() bool {
+		return len(a.pubsub.ListPeers(string(shared.CBORVersion.Topic))) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	q, _ := newTestQuery(t)
+	valid, err := shared.EncodeQuery(shared.CBORVersion.Codec, q)
+	require.NoError(t, err)
+
+	// the locally published junk is rejected by a's own validator, so only the valid query reaches b
+	for _, data := range [][]byte{[]byte("junk"), []byte(strings.Repeat("a", DefaultMaxMessageSize+1)), valid} {
+		err = a.Publish(ctx, shared.CBORVersion.Topic, data)
+		require.NoError(t, err)
+	}
+
+	select {
+	case msg := <-b.Messages():
+		require.Equal(t, valid, msg.Data)
+		require.Equal(t, a.PeerID(), msg.From)
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not receive valid query")
+	}
+
+	require.Eventually(t, func() bool {
+		return a.Rejected() == 2
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, uint64(1), b.Delivered())
+	require.Equal(t, uint64(0), b.Rejected())
+}
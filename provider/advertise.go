@@ -0,0 +1,84 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/routing"
+)
+
+// DefaultReprovideInterval is the default interval at which the store's CIDs are advertised again,
+// so the provider records don't expire from the DHT
+var DefaultReprovideInterval = 12 * time.Hour
+
+// SetContentRouting sets the content routing, such as a Kademlia DHT, used to advertise the CIDs in the
+// provider's store as provider records. Once started, the provider advertises its CIDs immediately and then
+// at the given interval, so clients can find it without gossiping a query. The store must implement
+// RetrievalProviderCIDStore. It must be called before Start.
+func (p *Provider) SetContentRouting(r routing.ContentRouting, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReprovideInterval
+	}
+	p.router = r
+	p.reprovideInterval = interval
+}
+
+// Advertise announces every CID in the provider's store through content routing.
+// CIDs that fail to be announced are logged and skipped, and an error is returned once all have been tried.
+func (p *Provider) Advertise(ctx context.Context) error {
+	if p.router == nil {
+		return ErrNoContentRouting
+	}
+
+	s, ok := p.store.(RetrievalProviderCIDStore)
+	if !ok {
+		return ErrStoreNotListable
+	}
+
+	cids := s.CIDs()
+	failed := 0
+	var lastErr error
+	for _, c := range cids {
+		err := p.router.Provide(ctx, c, true)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Debug("failed to advertise ", c, "; error: ", err)
+			failed++
+			lastErr = err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to advertise %d of %d cids: %w", failed, len(cids), lastErr)
+	}
+
+	log.Info("advertised ", len(cids), " cids")
+	return nil
+}
+
+// reprovide advertises the store's CIDs at the reprovide interval until the context is done
+func (p *Provider) reprovide(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.reprovideInterval)
+	defer ticker.Stop()
+
+	for {
+		err := p.Advertise(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error("failed to advertise cids; error: ", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
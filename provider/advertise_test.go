@@ -0,0 +1,97 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/cache"
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+var errTestProvide = errors.New("provide failed")
+
+type mockContentRouting struct {
+	lock     sync.Mutex
+	provided []cid.Cid
+	fail     map[cid.Cid]bool
+}
+
+func (r *mockContentRouting) Provide(_ context.Context, c cid.Cid, _ bool) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.fail[c] {
+		return errTestProvide
+	}
+	r.provided = append(r.provided, c)
+	return nil
+}
+
+func (r *mockContentRouting) FindProvidersAsync(context.Context, cid.Cid, int) <-chan peer.AddrInfo {
+	ch := make(chan peer.AddrInfo)
+	close(ch)
+	return ch
+}
+
+func (r *mockContentRouting) providedCIDs() []cid.Cid {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]cid.Cid{}, r.provided...)
+}
+
+type mockCIDStore struct {
+	*mockRetrievalProviderStore
+	cids []cid.Cid
+}
+
+func (s *mockCIDStore) CIDs() []cid.Cid {
+	return s.cids
+}
+
+func TestProvider_Advertise(t *testing.T) {
+	cids := []cid.Cid{
+		block.NewBlock([]byte("noot")).Cid(),
+		block.NewBlock([]byte("was")).Cid(),
+	}
+	s := &mockCIDStore{newTestRetrievalProviderStore(), cids}
+	r := &mockContentRouting{}
+
+	p := NewProvider(newMockNetwork(), s, cache.NewMockCache(testCacheSize))
+	require.Equal(t, ErrNoContentRouting, p.Advertise(context.Background()))
+
+	// the cids are advertised once started, and again at each interval
+	p.SetContentRouting(r, time.Millisecond*50)
+	err := p.Start(context.Background())
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return len(r.providedCIDs()) >= 4
+	}, time.Second, time.Millisecond)
+	require.ElementsMatch(t, cids, r.providedCIDs()[:2])
+
+	err = p.Stop(context.Background())
+	require.NoError(t, err)
+
+	// cids that fail to be advertised don't stop the others from being advertised
+	r = &mockContentRouting{fail: map[cid.Cid]bool{cids[0]: true}}
+	p.SetContentRouting(r, 0)
+	err = p.Advertise(context.Background())
+	require.True(t, errors.Is(err, errTestProvide))
+	require.Equal(t, cids[1:], r.providedCIDs())
+}
+
+func TestProvider_AdvertiseNotListable(t *testing.T) {
+	p := NewProvider(newMockNetwork(), newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
+	p.SetContentRouting(&mockContentRouting{}, 0)
+	require.Equal(t, ErrStoreNotListable, p.Advertise(context.Background()))
+	require.Equal(t, ErrStoreNotListable, p.Start(context.Background()))
+}
@@ -5,6 +5,7 @@ package provider
 
 import (
 	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
 
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/cache"
 )
@@ -14,6 +15,9 @@ type RequestCache interface {
 	// Put adds the cid to the cache or updates it if it already exists
 	Put(cid.Cid)
 
+	// PutFrom adds the cid to the cache or updates it, recording the client that requested it
+	PutFrom(cid.Cid, peer.ID)
+
 	// Keys returns all the keys in the cache
 	Keys() []cid.Cid
 
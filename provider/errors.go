@@ -12,3 +12,18 @@ var ErrNoAddrsProvided = errors.New("no client multiaddrs provided")
 
 // ErrConnectFailed is returned when a provider is unable to connect using any of the client's multiaddrs
 var ErrConnectFailed = errors.New("cannot connect to any provided multiaddrs")
+
+// ErrInvalidPriceBounds is returned when a pricing policy's price floor is above its ceiling
+var ErrInvalidPriceBounds = errors.New("price floor is greater than price ceiling")
+
+// ErrAlreadyStarted is returned when starting a provider that has already been started
+var ErrAlreadyStarted = errors.New("provider already started")
+
+// ErrStopped is returned when starting a provider that has been stopped
+var ErrStopped = errors.New("provider stopped")
+
+// ErrNoContentRouting is returned when advertising the store's CIDs without content routing set
+var ErrNoContentRouting = errors.New("content routing not set")
+
+// ErrStoreNotListable is returned when advertising the CIDs of a store that doesn't implement RetrievalProviderCIDStore
+var ErrStoreNotListable = errors.New("store cids can't be listed")
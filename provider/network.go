@@ -6,17 +6,22 @@ package provider
 import (
 	"context"
 
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
 	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 )
 
 // Network defines the libp2p network interface used by the Provider
 type Network interface {
-	Start() error
-	Stop() error
-	Messages() <-chan []byte
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	Messages() <-chan *shared.Message
 	MultiAddrs() []string
-	Connect(p peer.AddrInfo) error
+	Connect(ctx context.Context, p peer.AddrInfo) error
 	Send(context.Context, core.ProtocolID, peer.ID, []byte) error
 	PeerID() peer.ID
+	PrivKey() crypto.PrivKey
+	RegisterStreamHandler(core.ProtocolID, network.StreamHandler)
 }
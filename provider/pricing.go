@@ -0,0 +1,209 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package provider
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/cache"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+)
+
+// Terms are the terms a provider offers for retrieving data
+type Terms struct {
+	PricePerByte            abi.TokenAmount
+	PaymentInterval         uint64
+	PaymentIntervalIncrease uint64
+}
+
+// PricingPolicy determines the terms a provider offers in response to a query
+type PricingPolicy interface {
+	// Terms returns the terms to offer the client for the query.
+	// record is the request cache's Record for the queried payload CID, and base holds the
+	// provider's terms as set through SetPricePerByte and SetPaymentInterval.
+	Terms(query *shared.Query, client peer.ID, record *cache.Record, base Terms) (Terms, error)
+}
+
+// StaticPricing offers the provider's base terms for every query
+type StaticPricing struct{}
+
+// Terms returns the base terms
+func (StaticPricing) Terms(query *shared.Query, client peer.ID, record *cache.Record, base Terms) (Terms, error) {
+	return base, nil
+}
+
+// TablePricing offers terms set per CID, falling back to the provider's base terms for CIDs not in the table.
+// The payload CID of a query is looked up first, then its piece CID.
+type TablePricing struct {
+	table map[cid.Cid]Terms
+	lock  sync.RWMutex
+}
+
+// NewTablePricing returns a TablePricing with the given per-CID terms
+func NewTablePricing(table map[cid.Cid]Terms) *TablePricing {
+	t := &TablePricing{
+		table: make(map[cid.Cid]Terms),
+	}
+
+	for c, terms := range table {
+		t.table[c] = terms
+	}
+
+	return t
+}
+
+// Set sets the terms for the given CID
+func (t *TablePricing) Set(c cid.Cid, terms Terms) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.table[c] = terms
+}
+
+// Remove removes the terms for the given CID, so the base terms are offered for it
+func (t *TablePricing) Remove(c cid.Cid) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.table, c)
+}
+
+// Terms returns the terms for the queried CID, or the base terms if there are none
+func (t *TablePricing) Terms(query *shared.Query, client peer.ID, record *cache.Record, base Terms) (Terms, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if terms, has := t.table[query.Params.PayloadCID]; has {
+		return terms, nil
+	}
+
+	if query.Params.PieceCID != nil {
+		if terms, has := t.table[*query.Params.PieceCID]; has {
+			return terms, nil
+		}
+	}
+
+	return base, nil
+}
+
+// DefaultDemandWindow is the default period over which DemandPricing measures query rates
+var DefaultDemandWindow = time.Hour
+
+// DefaultQueryWeight is the default fractional price increase per query received in a demand window
+var DefaultQueryWeight = 0.01
+
+// DefaultClientWeight is the default fractional price increase per distinct client requesting a CID
+var DefaultClientWeight = 0.05
+
+// DefaultDemandHalfLife is the default time after which the demand for a CID that stopped being requested
+// counts for half as much
+var DefaultDemandHalfLife = 24 * time.Hour
+
+// demandPrecision is the fixed-point precision used to apply the demand multiplier to the price
+const demandPrecision = 1e6
+
+// maxDemandMultiplier bounds the demand multiplier so the fixed-point multiplier fits in an int64. Prices
+// are clamped to the ceiling well before it is reached.
+const maxDemandMultiplier = 1e12
+
+// DemandPricing adjusts the base price per byte by the observed demand for the queried CID, using its
+// Record in the request cache. Demand is measured as the number of queries received per Window since the
+// CID was first requested, so CIDs that were popular long ago become cheaper over time, along with the
+// number of distinct clients that requested it. Demand also decays with recency: it is halved for every HalfLife
+// the CID went unrequested before the current query, so a stale CID is cheaper than one in steady demand.
+// The offered price is base * (1 + recency*(QueryWeight*queriesPerWindow + ClientWeight*clients)), clamped to
+// [Floor, Ceiling], where recency is 0.5^(idle/HalfLife), or 1 if HalfLife is 0. Payment intervals are not changed.
+type DemandPricing struct {
+	Floor        abi.TokenAmount
+	Ceiling      abi.TokenAmount
+	Window       time.Duration
+	QueryWeight  float64
+	ClientWeight float64
+	HalfLife     time.Duration
+
+	now func() time.Time
+}
+
+// NewDemandPricing returns a DemandPricing with the given bounds and default weights
+func NewDemandPricing(floor, ceiling abi.TokenAmount) (*DemandPricing, error) {
+	if floor.GreaterThan(ceiling) {
+		return nil, ErrInvalidPriceBounds
+	}
+
+	return &DemandPricing{
+		Floor:        floor,
+		Ceiling:      ceiling,
+		Window:       DefaultDemandWindow,
+		QueryWeight:  DefaultQueryWeight,
+		ClientWeight: DefaultClientWeight,
+		HalfLife:     DefaultDemandHalfLife,
+		now:          time.Now,
+	}, nil
+}
+
+// Terms returns the base terms with the price per byte adjusted for demand
+func (d *DemandPricing) Terms(query *shared.Query, client peer.ID, record *cache.Record, base Terms) (Terms, error) {
+	demand := d.QueryWeight * d.queryRate(record)
+	if record != nil {
+		demand += d.ClientWeight * float64(record.Clients)
+	}
+	multiplier := 1 + d.recency(record)*demand
+	if !(multiplier < maxDemandMultiplier) { // also true for NaN
+		multiplier = maxDemandMultiplier
+	} else if multiplier < 0 {
+		multiplier = 0
+	}
+
+	price := big.Div(
+		big.Mul(base.PricePerByte, big.NewInt(int64(multiplier*demandPrecision))),
+		big.NewInt(demandPrecision),
+	)
+	price = big.Max(price, d.Floor)
+	price = big.Min(price, d.Ceiling)
+
+	return Terms{
+		PricePerByte:            price,
+		PaymentInterval:         base.PaymentInterval,
+		PaymentIntervalIncrease: base.PaymentIntervalIncrease,
+	}, nil
+}
+
+// queryRate returns the number of queries per Window since the record was inserted
+func (d *DemandPricing) queryRate(record *cache.Record) float64 {
+	if record == nil || record.InsertionTime.IsZero() || d.Window <= 0 {
+		return 0
+	}
+
+	now := time.Now
+	if d.now != nil {
+		now = d.now
+	}
+
+	age := now().Sub(record.InsertionTime)
+	if age < d.Window {
+		age = d.Window
+	}
+
+	return float64(record.Frequency) * float64(d.Window) / float64(age)
+}
+
+// recency returns the factor by which demand decays, given how long the record's CID went unrequested
+// before its last access
+func (d *DemandPricing) recency(record *cache.Record) float64 {
+	if record == nil || record.PreviousAccessed.IsZero() || d.HalfLife <= 0 {
+		return 1
+	}
+
+	idle := record.LastAccessed.Sub(record.PreviousAccessed)
+	if idle <= 0 {
+		return 1
+	}
+
+	return math.Pow(0.5, float64(idle)/float64(d.HalfLife))
+}
@@ -0,0 +1,232 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/cache"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+)
+
+var testBaseTerms = Terms{
+	PricePerByte:            DefaultPricePerByte,
+	PaymentInterval:         DefaultPaymentInterval,
+	PaymentIntervalIncrease: DefaultPaymentIntervalIncrease,
+}
+
+func TestStaticPricing(t *testing.T) {
+	query := &shared.Query{Params: shared.Params{PayloadCID: block.NewBlock([]byte("noot")).Cid()}}
+	terms, err := StaticPricing{}.Terms(query, "", &cache.Record{}, testBaseTerms)
+	require.NoError(t, err)
+	require.Equal(t, testBaseTerms, terms)
+}
+
+func TestTablePricing(t *testing.T) {
+	payloadCID := block.NewBlock([]byte("noot")).Cid()
+	pieceCID := block.NewBlock([]byte("was")).Cid()
+	otherCID := block.NewBlock([]byte("here")).Cid()
+
+	payloadTerms := Terms{PricePerByte: abi.NewTokenAmount(5), PaymentInterval: 1, PaymentIntervalIncrease: 2}
+	pieceTerms := Terms{PricePerByte: abi.NewTokenAmount(7), PaymentInterval: 3, PaymentIntervalIncrease: 4}
+
+	pricing := NewTablePricing(map[cid.Cid]Terms{
+		payloadCID: payloadTerms,
+	})
+	pricing.Set(pieceCID, pieceTerms)
+
+	// payload CID takes precedence over piece CID
+	query := &shared.Query{Params: shared.Params{PayloadCID: payloadCID, PieceCID: &pieceCID}}
+	terms, err := pricing.Terms(query, "", &cache.Record{}, testBaseTerms)
+	require.NoError(t, err)
+	require.Equal(t, payloadTerms, terms)
+
+	// falls back to piece CID
+	query = &shared.Query{Params: shared.Params{PayloadCID: otherCID, PieceCID: &pieceCID}}
+	terms, err = pricing.Terms(query, "", &cache.Record{}, testBaseTerms)
+	require.NoError(t, err)
+	require.Equal(t, pieceTerms, terms)
+
+	// falls back to base terms
+	pricing.Remove(pieceCID)
+	terms, err = pricing.Terms(query, "", &cache.Record{}, testBaseTerms)
+	require.NoError(t, err)
+	require.Equal(t, testBaseTerms, terms)
+}
+
+func TestDemandPricing(t *testing.T) {
+	now := time.Now()
+	pricing, err := NewDemandPricing(abi.NewTokenAmount(1), abi.NewTokenAmount(1000))
+	require.NoError(t, err)
+	pricing.now = func() time.Time { return now }
+
+	base := Terms{PricePerByte: abi.NewTokenAmount(100), PaymentInterval: 1, PaymentIntervalIncrease: 2}
+	query := &shared.Query{Params: shared.Params{PayloadCID: block.NewBlock([]byte("noot")).Cid()}}
+
+	testCases := []struct {
+		name     string
+		record   *cache.Record
+		base     Terms
+		expected int64
+	}{
+		{"no record", nil, base, 100},
+		{"recent demand", &cache.Record{Frequency: 10, InsertionTime: now.Add(-30 * time.Minute)}, base, 110},
+		{"old demand", &cache.Record{Frequency: 10, InsertionTime: now.Add(-10 * time.Hour)}, base, 101},
+		{"clients", &cache.Record{Frequency: 10, InsertionTime: now.Add(-30 * time.Minute), Clients: 2}, base, 120},
+		{"ceiling", &cache.Record{Frequency: 1000, InsertionTime: now}, base, 1000},
+		{"floor", nil, Terms{PricePerByte: abi.NewTokenAmount(0)}, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			terms, err := pricing.Terms(query, "", tc.record, tc.base)
+			require.NoError(t, err)
+			require.Equal(t, abi.NewTokenAmount(tc.expected), terms.PricePerByte)
+			require.Equal(t, tc.base.PaymentInterval, terms.PaymentInterval)
+			require.Equal(t, tc.base.PaymentIntervalIncrease, terms.PaymentIntervalIncrease)
+		})
+	}
+
+	_, err = NewDemandPricing(abi.NewTokenAmount(2), abi.NewTokenAmount(1))
+	require.Equal(t, ErrInvalidPriceBounds, err)
+}
+
+func TestDemandPricing_Recency(t *testing.T) {
+	now := time.Now()
+	pricing, err := NewDemandPricing(abi.NewTokenAmount(1), abi.NewTokenAmount(1000))
+	require.NoError(t, err)
+	pricing.now = func() time.Time { return now }
+
+	base := Terms{PricePerByte: abi.NewTokenAmount(100)}
+	query := &shared.Query{Params: shared.Params{PayloadCID: block.NewBlock([]byte("noot")).Cid()}}
+
+	// both CIDs have the same demand, but the stale one went unrequested for a day before the current query
+	recent := &cache.Record{
+		Frequency:        10,
+		InsertionTime:    now.Add(-30 * time.Minute),
+		PreviousAccessed: now.Add(-time.Minute),
+		LastAccessed:     now,
+		Clients:          2,
+	}
+	stale := &cache.Record{
+		Frequency:        10,
+		InsertionTime:    now.Add(-30 * time.Minute),
+		PreviousAccessed: now.Add(-pricing.HalfLife),
+		LastAccessed:     now,
+		Clients:          2,
+	}
+
+	recentTerms, err := pricing.Terms(query, "", recent, base)
+	require.NoError(t, err)
+	staleTerms, err := pricing.Terms(query, "", stale, base)
+	require.NoError(t, err)
+
+	require.True(t, staleTerms.PricePerByte.LessThan(recentTerms.PricePerByte))
+	// the stale CID's demand is halved after one half-life
+	require.Equal(t, abi.NewTokenAmount(110), staleTerms.PricePerByte)
+
+	// without a half-life, recency is ignored
+	pricing.HalfLife = 0
+	staleTerms, err = pricing.Terms(query, "", stale, base)
+	require.NoError(t, err)
+	require.Equal(t, abi.NewTokenAmount(120), staleTerms.PricePerByte)
+}
+
+func TestDemandPricing_Literal(t *testing.T) {
+	// a DemandPricing built without NewDemandPricing uses the current time
+	pricing := &DemandPricing{
+		Floor:       abi.NewTokenAmount(1),
+		Ceiling:     abi.NewTokenAmount(1000),
+		Window:      time.Hour,
+		QueryWeight: 1e300,
+	}
+
+	base := Terms{PricePerByte: abi.NewTokenAmount(100)}
+	query := &shared.Query{Params: shared.Params{PayloadCID: block.NewBlock([]byte("noot")).Cid()}}
+	record := &cache.Record{Frequency: 10, InsertionTime: time.Now().Add(-30 * time.Minute)}
+
+	// a multiplier too large for the fixed-point conversion is clamped, then the price to the ceiling
+	terms, err := pricing.Terms(query, "", record, base)
+	require.NoError(t, err)
+	require.Equal(t, abi.NewTokenAmount(1000), terms.PricePerByte)
+
+	// as is a negative one, to the floor
+	pricing.QueryWeight = -1
+	terms, err = pricing.Terms(query, "", record, base)
+	require.NoError(t, err)
+	require.Equal(t, abi.NewTokenAmount(1), terms.PricePerByte)
+}
+
+type mockPricingPolicy struct {
+	client peer.ID
+	record *cache.Record
+	terms  Terms
+}
+
+func (m *mockPricingPolicy) Terms(query *shared.Query, client peer.ID, record *cache.Record, base Terms) (Terms, error) {
+	m.client = client
+	m.record = record
+	return m.terms, nil
+}
+
+func TestProvider_PricingPolicy(t *testing.T) {
+	n := newMockNetwork()
+	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewLFUCache(testCacheSize))
+
+	policy := &mockPricingPolicy{
+		terms: Terms{PricePerByte: abi.NewTokenAmount(9), PaymentInterval: 8, PaymentIntervalIncrease: 7},
+	}
+	p.SetPricingPolicy(policy)
+
+	err := p.Start(context.Background())
+	require.NoError(t, err)
+
+	defer func() {
+		err = p.Stop(context.Background())
+		require.NoError(t, err)
+	}()
+
+	b := block.NewBlock([]byte("noot"))
+	err = p.store.(*mockRetrievalProviderStore).bs.Put(b)
+	require.NoError(t, err)
+
+	query := &shared.Query{
+		ID:          shared.NewQueryID(),
+		Params:      shared.Params{PayloadCID: b.Cid()},
+		ClientAddrs: []string{testMultiAddrStr},
+	}
+
+	bz, err := query.Marshal()
+	require.NoError(t, err)
+	n.msgs <- newTestMessage(shared.RetrievalProtocolID, bz)
+
+	resp := &shared.QueryResponse{
+		ID:                      query.ID,
+		Params:                  query.Params,
+		Provider:                n.PeerID(),
+		PricePerByte:            policy.terms.PricePerByte,
+		PaymentInterval:         policy.terms.PaymentInterval,
+		PaymentIntervalIncrease: policy.terms.PaymentIntervalIncrease,
+	}
+	err = resp.Sign(n.key)
+	require.NoError(t, err)
+
+	expected, err := shared.EncodeResponse(shared.JSONCodec, resp)
+	require.NoError(t, err)
+	requireSent(t, n, expected)
+
+	// the policy is given the client's peer ID and the record including this query
+	clientAddr, err := shared.StringToAddrInfo(testMultiAddrStr)
+	require.NoError(t, err)
+	require.Equal(t, clientAddr.ID, policy.client)
+	require.Equal(t, 1, policy.record.Frequency)
+}
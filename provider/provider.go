@@ -4,13 +4,21 @@
 package provider
 
 import (
+	"bufio"
 	"context"
+	"io"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
 	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
 )
 
 var log = logging.Logger("provider")
@@ -27,27 +35,53 @@ var DefaultPaymentInterval = uint64(1 << 20)
 // set to to 1Mb if the miner does not explicitly set it otherwise
 var DefaultPaymentIntervalIncrease = uint64(1 << 20)
 
+// DefaultMaxQuerySize is the default size limit of a direct query, in bytes, the same as the network's
+// default limit for gossiped queries
+var DefaultMaxQuerySize = 4 << 10
+
 type ProviderSubscriber func(query shared.Query)
 type Unsubscribe func()
 
 // Provider ...
 type Provider struct {
+	dropped   uint64 // number of gossiped queries dropped because the queue was full, accessed atomically
+	throttled uint64 // number of queries dropped by the rate limiters, accessed atomically
+
 	net             Network
 	store           RetrievalProviderStore
 	cache           RequestCache
-	msgs            <-chan []byte
+	msgs            <-chan *shared.Message
 	subscribers     []ProviderSubscriber
 	subscribersLock sync.Mutex
 
 	pricePerByte            abi.TokenAmount
 	paymentInterval         uint64
 	paymentIntervalIncrease uint64
+	priceOnRequest          bool
+	pricing                 PricingPolicy
 	priceLock               sync.Mutex
+
+	workers         int
+	queueSize       int
+	queuePolicy     QueuePolicy
+	responseTimeout time.Duration
+	maxQuerySize    int
+
+	sourceLimiter *rateLimiter // limits queries per gossip source, nil if disabled
+	clientLimiter *rateLimiter // limits queries per client, nil if disabled
+
+	router            routing.ContentRouting // advertises the store's CIDs, nil if disabled
+	reprovideInterval time.Duration
+
+	lifecycleLock sync.Mutex
+	cancel        context.CancelFunc // stops handling gossiped queries, nil if not started
+	stopping      bool
+	wg            sync.WaitGroup // tracks the message loop, workers and in-flight direct queries
 }
 
 // NewProvider returns a new Provider
 func NewProvider(net Network, s RetrievalProviderStore, cache RequestCache) *Provider {
-	return &Provider{
+	p := &Provider{
 		net:                     net,
 		store:                   s,
 		cache:                   cache,
@@ -55,24 +89,156 @@ func NewProvider(net Network, s RetrievalProviderStore, cache RequestCache) *Pro
 		pricePerByte:            DefaultPricePerByte,
 		paymentInterval:         DefaultPaymentInterval,
 		paymentIntervalIncrease: DefaultPaymentIntervalIncrease,
+		pricing:                 StaticPricing{},
+		workers:                 DefaultWorkers,
+		queueSize:               DefaultQueueSize,
+		queuePolicy:             QueueDrop,
+		responseTimeout:         DefaultResponseTimeout,
+		maxQuerySize:            DefaultMaxQuerySize,
 	}
+
+	p.SetRateLimit(DefaultRateLimit, DefaultRateBurst)
+
+	// Register handlers for direct client queries
+	for _, v := range shared.Versions {
+		p.net.RegisterStreamHandler(v.Query, p.HandleQueryStream)
+	}
+
+	return p
 }
 
-// Start starts the provider
-func (p *Provider) Start() error {
-	err := p.net.Start()
+// Start starts the provider, handling gossiped queries until Stop is called or the context is done
+func (p *Provider) Start(ctx context.Context) error {
+	p.lifecycleLock.Lock()
+	defer p.lifecycleLock.Unlock()
+
+	if p.stopping {
+		return ErrStopped
+	}
+
+	if p.cancel != nil {
+		return ErrAlreadyStarted
+	}
+
+	if _, ok := p.store.(RetrievalProviderCIDStore); p.router != nil && !ok {
+		return ErrStoreNotListable
+	}
+
+	err := p.net.Start(ctx)
 	if err != nil {
 		return err
 	}
 
+	ctx, p.cancel = context.WithCancel(ctx)
 	p.msgs = p.net.Messages()
-	go p.handleMessages()
+	queue := make(chan *shared.Message, p.queueSize)
+
+	p.wg.Add(1 + p.workers)
+	go p.handleMessages(ctx, queue)
+	for i := 0; i < p.workers; i++ {
+		go p.work(ctx, queue)
+	}
+
+	if p.router != nil {
+		p.wg.Add(1)
+		go p.reprovide(ctx)
+	}
+
 	return nil
 }
 
-// Stop stops the provider
-func (p *Provider) Stop() error {
-	return p.net.Stop()
+// Stop stops handling queries, waits for responses that are already being sent, then stops the network.
+// Queued queries that haven't been picked up by a worker are dropped.
+// If the context is done before the responses have been sent, the network is stopped regardless.
+func (p *Provider) Stop(ctx context.Context) error {
+	p.lifecycleLock.Lock()
+	p.stopping = true
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.lifecycleLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn("timed out waiting for in-flight responses to be sent")
+	}
+
+	return p.net.Stop(ctx)
+}
+
+// track registers an in-flight query, returning false if the provider is stopping.
+// If it returns true, p.wg.Done must be called once the query has been handled.
+func (p *Provider) track() bool {
+	p.lifecycleLock.Lock()
+	defer p.lifecycleLock.Unlock()
+
+	if p.stopping {
+		return false
+	}
+
+	p.wg.Add(1)
+	return true
+}
+
+// SetWorkers sets the number of gossiped queries handled at once. It must be called before Start.
+func (p *Provider) SetWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	p.workers = workers
+}
+
+// SetQueue sets the number of gossiped queries that can wait for a worker, and what happens to
+// queries received while the queue is full. It must be called before Start.
+func (p *Provider) SetQueue(size int, policy QueuePolicy) {
+	if size < 0 {
+		size = 0
+	}
+	p.queueSize = size
+	p.queuePolicy = policy
+}
+
+// SetResponseTimeout sets the time allowed to connect to a client and send it a response to a gossiped query,
+// and the time allowed for a client to send a direct query and read the response. It must be called before Start.
+func (p *Provider) SetResponseTimeout(timeout time.Duration) {
+	p.responseTimeout = timeout
+}
+
+// SetMaxQuerySize sets the size limit of direct queries, in bytes. Larger queries are dropped.
+// It must be called before Start.
+func (p *Provider) SetMaxQuerySize(size int) {
+	p.maxQuerySize = size
+}
+
+// SetRateLimit sets the number of queries per second handled from each gossip source and from each
+// client, and the number that can be sent at once. Queries beyond the limit are dropped.
+// Direct queries count against both limits of the peer that opened the stream.
+// A rate of 0 or less disables rate limiting. It must be called before Start.
+func (p *Provider) SetRateLimit(rate float64, burst int) {
+	if rate <= 0 {
+		p.sourceLimiter, p.clientLimiter = nil, nil
+		return
+	}
+	p.sourceLimiter = newRateLimiter(rate, burst)
+	p.clientLimiter = newRateLimiter(rate, burst)
+}
+
+// DroppedQueries returns the number of gossiped queries dropped because the queue was full
+func (p *Provider) DroppedQueries() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// ThrottledQueries returns the number of queries dropped because their gossip source or client
+// exceeded the rate limit
+func (p *Provider) ThrottledQueries() uint64 {
+	return atomic.LoadUint64(&p.throttled)
 }
 
 // SetPricePerByte sets the provider's pricePerByte
@@ -90,6 +256,34 @@ func (p *Provider) SetPaymentInterval(interval, increase uint64) {
 	p.paymentIntervalIncrease = increase
 }
 
+// Terms returns the provider's base terms, set with SetPricePerByte and SetPaymentInterval
+func (p *Provider) Terms() Terms {
+	p.priceLock.Lock()
+	defer p.priceLock.Unlock()
+	return Terms{
+		PricePerByte:            p.pricePerByte,
+		PaymentInterval:         p.paymentInterval,
+		PaymentIntervalIncrease: p.paymentIntervalIncrease,
+	}
+}
+
+// SetPricingPolicy sets the policy used to determine the terms offered in each response.
+// The provider's price and payment interval are passed to the policy as its base terms.
+// It defaults to StaticPricing, which offers the base terms for every query.
+func (p *Provider) SetPricingPolicy(policy PricingPolicy) {
+	p.priceLock.Lock()
+	defer p.priceLock.Unlock()
+	p.pricing = policy
+}
+
+// SetPriceOnRequest sets whether the provider withholds its terms, responding to queries for
+// available data with status QueryResponsePriceOnRequest
+func (p *Provider) SetPriceOnRequest(priceOnRequest bool) {
+	p.priceLock.Lock()
+	defer p.priceLock.Unlock()
+	p.priceOnRequest = priceOnRequest
+}
+
 // SubscribeToQueries registers the given subscriber and calls it upon receiving queries
 func (p *Provider) SubscribeToQueries(s ProviderSubscriber) Unsubscribe {
 	p.subscribersLock.Lock()
@@ -114,34 +308,195 @@ func (p *Provider) unsubscribeAt(s ProviderSubscriber) Unsubscribe {
 	}
 }
 
-func (p *Provider) handleMessages() {
-	for msg := range p.msgs {
-		query := new(shared.Query)
-		err := query.Unmarshal(msg)
+// handleMessages queues gossiped queries for the workers until the context is done or the network's
+// messages are closed, then closes the queue
+func (p *Provider) handleMessages(ctx context.Context, queue chan<- *shared.Message) {
+	defer p.wg.Done()
+	defer close(queue)
+
+	for {
+		select {
+		case msg, ok := <-p.msgs:
+			if !ok {
+				return
+			}
+			p.enqueue(ctx, queue, msg)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// enqueue queues the message for the workers according to the provider's queue policy
+func (p *Provider) enqueue(ctx context.Context, queue chan<- *shared.Message, msg *shared.Message) {
+	// the source is checked before queueing, so a flood from one peer can't fill the queue
+	if p.sourceLimiter != nil && !p.sourceLimiter.allow(msg.From) {
+		atomic.AddUint64(&p.throttled, 1)
+		log.Debug("rate limit exceeded, dropping query from ", msg.From)
+		return
+	}
+
+	if p.queuePolicy == QueueBlock {
+		select {
+		case queue <- msg:
+		case <-ctx.Done():
+		}
+		return
+	}
+
+	select {
+	case queue <- msg:
+	default:
+		atomic.AddUint64(&p.dropped, 1)
+		log.Warn("query queue is full, dropping query from ", msg.From)
+	}
+}
+
+// work handles queued queries until the queue is closed or the context is done
+func (p *Provider) work(ctx context.Context, queue <-chan *shared.Message) {
+	defer p.wg.Done()
+
+	for msg := range queue {
+		if ctx.Err() != nil {
+			return
+		}
+		p.handleMessage(msg)
+	}
+}
+
+// handleMessage handles a gossiped query, responding if the data is available
+func (p *Provider) handleMessage(msg *shared.Message) {
+	v, ok := shared.VersionFor(msg.Topic)
+	if !ok {
+		log.Error("received message on unknown topic ", msg.Topic)
+		return
+	}
+
+	query, err := shared.DecodeQuery(v.Codec, msg.Data)
+	if err != nil {
+		log.Error("cannot unmarshal query; error:", err)
+		return
+	}
+
+	if query.Signed() {
+		err = query.Verify()
+		if err != nil {
+			log.Warn("dropping query with invalid signature; error: ", err)
+			return
+		}
+	}
+
+	if client := queryClient(query, msg.From); p.clientLimiter != nil && !p.clientLimiter.allow(client) {
+		atomic.AddUint64(&p.throttled, 1)
+		log.Debug("rate limit exceeded, dropping query ", query.ID, " from client ", client)
+		return
+	}
+
+	p.notifySubscribers(*query)
+
+	log.Info("received query ", query.ID, " for params", query.Params)
+	availability, err := p.availability(query.Params)
+	if err != nil {
+		log.Error("failed to check for data in blockstore; error:", err)
+		return
+	}
+
+	// TODO: update cache to accept params?
+	p.cache.PutFrom(query.Params.PayloadCID, queryClient(query, msg.From))
+
+	// only queries sent directly to the provider are answered when the data is unavailable
+	if availability.Status != shared.QueryResponseUnavailable {
+		err = p.sendResponse(query, availability, v)
 		if err != nil {
-			log.Error("cannot unmarshal query; error:", err)
-			continue
+			log.Error("cannot send response; error: ", err)
 		}
+	}
+}
 
-		p.notifySubscribers(*query)
+// HandleQueryStream reads a query sent directly by a client and writes the response on the same stream.
+// Unlike gossiped queries, a response is always sent, with status QueryResponseUnavailable
+// if the provider does not have the requested data, and regardless of the query's constraints.
+// Note: implements the libp2p StreamHandler interface
+func (p *Provider) HandleQueryStream(s network.Stream) {
+	log.Debug("got query stream from peer ", s.Conn().RemotePeer())
 
-		log.Info("received query for params", query.Params)
-		has, err := p.hasData(query.Params)
+	if !p.track() {
+		_ = s.Reset()
+		return
+	}
+	defer p.wg.Done()
+
+	v, ok := shared.VersionFor(s.Protocol())
+	if !ok {
+		log.Error("received query stream with unknown protocol ", s.Protocol())
+		_ = s.Reset()
+		return
+	}
+
+	// the peer that opened the stream is both the source and the client of a direct query
+	client := s.Conn().RemotePeer()
+	if !p.allowDirect(client) {
+		atomic.AddUint64(&p.throttled, 1)
+		log.Debug("rate limit exceeded, dropping direct query from ", client)
+		_ = s.Reset()
+		return
+	}
+
+	// the client has until the response timeout to send its query and read the response, so a stalled
+	// stream can't hold up Stop, and queries are limited to the size of a gossiped query
+	if p.responseTimeout > 0 {
+		err := s.SetDeadline(time.Now().Add(p.responseTimeout))
 		if err != nil {
-			log.Error("failed to check for data in blockstore; error:", err)
-			continue
+			log.Error("cannot set query stream deadline; error: ", err)
+			_ = s.Reset()
+			return
 		}
+	}
 
-		if has {
-			err = p.sendResponse(query)
-			if err != nil {
-				log.Error("cannot send response; error: ", err)
-			}
+	query := new(shared.Query)
+	err := v.Codec.DecodeQuery(bufio.NewReader(io.LimitReader(s, int64(p.maxQuerySize))), query)
+	if err != nil {
+		log.Error("cannot unmarshal query; error:", err)
+		_ = s.Reset()
+		return
+	}
+
+	if query.Signed() {
+		err = query.Verify()
+		if err != nil {
+			log.Warn("dropping query with invalid signature; error: ", err)
+			_ = s.Reset()
+			return
 		}
+	}
+
+	p.notifySubscribers(*query)
+
+	log.Info("received direct query ", query.ID, " for params", query.Params)
+	availability, err := p.availability(query.Params)
+	if err != nil {
+		log.Error("failed to check for data in blockstore; error:", err)
+		_ = s.Reset()
+		return
+	}
 
-		// TODO: update cache to accept params?
-		p.cache.Put(query.Params.PayloadCID)
+	p.cache.PutFrom(query.Params.PayloadCID, client)
+
+	resp, err := p.newResponse(query, client, availability)
+	if err != nil {
+		log.Error("cannot create response; error: ", err)
+		_ = s.Reset()
+		return
+	}
+
+	err = v.Codec.EncodeResponse(s, resp)
+	if err != nil {
+		log.Error("cannot send response; error: ", err)
+		_ = s.Reset()
+		return
 	}
+
+	_ = s.Close()
 }
 
 func (p *Provider) notifySubscribers(query shared.Query) {
@@ -153,50 +508,147 @@ func (p *Provider) notifySubscribers(query shared.Query) {
 	}
 }
 
-func (p *Provider) sendResponse(query *shared.Query) error {
+// sendResponse dials the client and sends the response using the given protocol version,
+// giving up if it can't be sent within the provider's response timeout
+func (p *Provider) sendResponse(query *shared.Query, availability Availability, v shared.Version) error {
 	if len(query.ClientAddrs) == 0 {
 		return ErrNoAddrsProvided
 	}
 
-	resp := &shared.QueryResponse{
-		Params:                  query.Params,
-		Provider:                p.net.PeerID(),
-		PricePerByte:            p.pricePerByte,
-		PaymentInterval:         p.paymentInterval,
-		PaymentIntervalIncrease: p.paymentIntervalIncrease,
-	}
-
 	addrs, err := shared.StringsToAddrInfos(query.ClientAddrs)
 	if err != nil {
 		log.Error("cannot convert client addrs to multiaddrs; error: ", err)
 		return err
 	}
 
-	for i, addr := range addrs {
-		// TODO: check if already connected using client's peer ID
-		err = p.net.Connect(addr)
-		if err != nil {
-			log.Error("failed to connect to addr: ", err)
+	resp, err := p.newResponse(query, addrs[0].ID, availability)
+	if err != nil {
+		return err
+	}
 
-			// couldn't connect using any addrs
-			if i == len(addrs)-1 {
-				return ErrConnectFailed
-			}
+	if !query.Constraints.Accepts(resp) {
+		log.Debug("not responding to query ", query.ID, "; terms do not satisfy the client's constraints")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.responseTimeout)
+	defer cancel()
 
-			continue
+	// TODO: check if already connected using client's peer ID
+	connected := false
+	for _, addr := range addrs {
+		err = p.net.Connect(ctx, addr)
+		if err == nil {
+			connected = true
+			break
+		}
+
+		log.Error("failed to connect to addr: ", err)
+		if ctx.Err() != nil {
+			break
 		}
 	}
 
-	bz, err := resp.Marshal()
+	if !connected {
+		return ErrConnectFailed
+	}
+
+	bz, err := shared.EncodeResponse(v.Codec, resp)
 	if err != nil {
 		return err
 	}
 
 	// TODO: if we open up a substream with the client, what protocol ID do we use?
 	// or do we use the existing /fil/markets stream?
-	return p.net.Send(context.Background(), shared.ResponseProtocolID, addrs[0].ID, bz)
+	return p.net.Send(ctx, v.Response, addrs[0].ID, bz)
+}
+
+// newResponse returns a signed response to the given query from the given client, with the terms
+// determined by the provider's pricing policy. Terms are only included if the data is available
+// now or later, and the provider isn't pricing on request.
+func (p *Provider) newResponse(query *shared.Query, client peer.ID, availability Availability) (*shared.QueryResponse, error) {
+	resp := &shared.QueryResponse{
+		ID:           query.ID,
+		Params:       query.Params,
+		Status:       availability.Status,
+		Provider:     p.net.PeerID(),
+		PricePerByte: big.Zero(),
+	}
+
+	p.priceLock.Lock()
+	base := Terms{
+		PricePerByte:            p.pricePerByte,
+		PaymentInterval:         p.paymentInterval,
+		PaymentIntervalIncrease: p.paymentIntervalIncrease,
+	}
+	pricing := p.pricing
+	if p.priceOnRequest && availability.Status == shared.QueryResponseAvailable {
+		resp.Status = shared.QueryResponsePriceOnRequest
+	}
+	p.priceLock.Unlock()
+
+	switch resp.Status {
+	case shared.QueryResponseAvailableLater:
+		resp.ETA = uint64(availability.ETA.Seconds())
+		fallthrough
+	case shared.QueryResponseAvailable:
+		record := p.cache.GetRecord(query.Params.PayloadCID)
+		terms, err := pricing.Terms(query, client, record, base)
+		if err != nil {
+			return nil, err
+		}
+
+		resp.PricePerByte = terms.PricePerByte
+		resp.PaymentInterval = terms.PaymentInterval
+		resp.PaymentIntervalIncrease = terms.PaymentIntervalIncrease
+	}
+
+	err := resp.Sign(p.net.PrivKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// allowDirect takes a token from the peer's buckets in both rate limiters, returning false if either is empty
+func (p *Provider) allowDirect(client peer.ID) bool {
+	if p.sourceLimiter != nil && !p.sourceLimiter.allow(client) {
+		return false
+	}
+	return p.clientLimiter == nil || p.clientLimiter.allow(client)
+}
+
+// queryClient returns the peer ID of the client that submitted a gossiped query, or the peer that
+// published it if it has no valid client multiaddrs, so such queries aren't all counted as one client
+func queryClient(query *shared.Query, from peer.ID) peer.ID {
+	if len(query.ClientAddrs) == 0 {
+		return from
+	}
+
+	addr, err := shared.StringToAddrInfo(query.ClientAddrs[0])
+	if err != nil {
+		return from
+	}
+
+	return addr.ID
 }
 
-func (p *Provider) hasData(params shared.Params) (bool, error) {
-	return p.store.Has(params)
+// availability returns the availability of the requested data, using the store's Status if it
+// implements RetrievalProviderStatusStore
+func (p *Provider) availability(params shared.Params) (Availability, error) {
+	if s, ok := p.store.(RetrievalProviderStatusStore); ok {
+		return s.Status(params)
+	}
+
+	has, err := p.store.Has(params)
+	if err != nil {
+		return Availability{}, err
+	}
+
+	if has {
+		return Availability{Status: shared.QueryResponseAvailable}, nil
+	}
+
+	return Availability{Status: shared.QueryResponseUnavailable}, nil
 }
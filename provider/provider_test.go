@@ -5,16 +5,23 @@ package provider
 
 import (
 	"context"
+	"crypto/rand"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/cache"
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
 	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
 	block "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 
 	"github.com/stretchr/testify/require"
@@ -25,25 +32,43 @@ var testCacheSize = 64
 var testTimeout = time.Second * 15
 
 type mockNetwork struct {
-	msgs chan []byte
-	sent []byte
+	msgs     chan *shared.Message
+	sent     []sentMessage // guarded by lock, read with sentMessages
+	key      crypto.PrivKey
+	sending  chan struct{} // if set, Send blocks until it is closed or its context is done
+	inflight int32         // number of blocked calls to Send
+	stopped  bool
+	lock     sync.Mutex
+}
+
+// sentMessage is a message sent through the mock network
+type sentMessage struct {
+	protocol core.ProtocolID
+	data     []byte
 }
 
 func newMockNetwork() *mockNetwork {
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
 	return &mockNetwork{
-		msgs: make(chan []byte),
+		msgs: make(chan *shared.Message),
+		key:  key,
 	}
 }
 
-func (n *mockNetwork) Start() error {
+func (n *mockNetwork) Start(ctx context.Context) error {
 	return nil
 }
 
-func (n *mockNetwork) Stop() error {
+func (n *mockNetwork) Stop(ctx context.Context) error {
+	n.stopped = true
 	return nil
 }
 
-func (n *mockNetwork) Messages() <-chan []byte {
+func (n *mockNetwork) Messages() <-chan *shared.Message {
 	return n.msgs
 }
 
@@ -51,23 +76,68 @@ func (n *mockNetwork) MultiAddrs() []string {
 	return []string{testMultiAddrStr}
 }
 
-func (n *mockNetwork) Connect(p peer.AddrInfo) error {
+func (n *mockNetwork) Connect(ctx context.Context, p peer.AddrInfo) error {
 	return nil
 }
 
 func (n *mockNetwork) Send(ctx context.Context, protocol core.ProtocolID, id peer.ID, msg []byte) error {
-	n.sent = msg
+	if n.sending != nil {
+		atomic.AddInt32(&n.inflight, 1)
+		defer atomic.AddInt32(&n.inflight, -1)
+
+		select {
+		case <-n.sending:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.sent = append(n.sent, sentMessage{protocol: protocol, data: msg})
 	return nil
 }
 
+// sentMessages returns a copy of the messages sent so far
+func (n *mockNetwork) sentMessages() []sentMessage {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return append([]sentMessage{}, n.sent...)
+}
+
+// requireSent waits for a single message to have been sent, and asserts that it's the expected one
+func requireSent(t *testing.T, n *mockNetwork, expected []byte) sentMessage {
+	require.Eventually(t, func() bool {
+		return len(n.sentMessages()) > 0
+	}, time.Second, time.Millisecond)
+
+	sent := n.sentMessages()
+	require.Len(t, sent, 1)
+	require.Equal(t, expected, sent[0].data)
+	return sent[0]
+}
+
 func (n *mockNetwork) PeerID() peer.ID {
-	id, err := peer.Decode("QmYyQSo1c1Ym7orWxLYvCrM2EmxFTANf8wXmmE7DWjhx5N")
+	id, err := peer.IDFromPrivateKey(n.key)
 	if err != nil {
 		panic(err)
 	}
 	return id
 }
 
+func (n *mockNetwork) PrivKey() crypto.PrivKey {
+	return n.key
+}
+
+func (n *mockNetwork) RegisterStreamHandler(id core.ProtocolID, handler network.StreamHandler) {}
+
+func newTestMessage(topic core.ProtocolID, data []byte) *shared.Message {
+	return &shared.Message{
+		Topic: topic,
+		Data:  data,
+	}
+}
+
 type mockRetrievalProviderStore struct {
 	bs blockstore.Blockstore
 }
@@ -90,26 +160,26 @@ func newTestBlockstore() blockstore.Blockstore {
 func TestProvider(t *testing.T) {
 	n := newMockNetwork()
 	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
-	err := p.Start()
+	err := p.Start(context.Background())
 	require.NoError(t, err)
 
 	defer func() {
-		err = p.Stop()
+		err = p.Stop(context.Background())
 		require.NoError(t, err)
 	}()
 
 	msg := []byte("bork")
-	n.msgs <- msg
+	n.msgs <- newTestMessage(shared.RetrievalProtocolID, msg)
 }
 
 func TestProvider_Response(t *testing.T) {
 	n := newMockNetwork()
 	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
-	err := p.Start()
+	err := p.Start(context.Background())
 	require.NoError(t, err)
 
 	defer func() {
-		err = p.Stop()
+		err = p.Stop(context.Background())
 		require.NoError(t, err)
 	}()
 
@@ -120,6 +190,7 @@ func TestProvider_Response(t *testing.T) {
 	require.NoError(t, err)
 
 	query := &shared.Query{
+		ID: shared.NewQueryID(),
 		Params: shared.Params{
 			PayloadCID: testCid,
 		},
@@ -129,26 +200,361 @@ func TestProvider_Response(t *testing.T) {
 	bz, err := query.Marshal()
 	require.NoError(t, err)
 
-	n.msgs <- bz
+	n.msgs <- newTestMessage(shared.RetrievalProtocolID, bz)
 
 	resp := &shared.QueryResponse{
+		ID:                      query.ID,
 		Params:                  query.Params,
 		Provider:                n.PeerID(),
 		PricePerByte:            p.pricePerByte,
 		PaymentInterval:         DefaultPaymentInterval,
 		PaymentIntervalIncrease: DefaultPaymentIntervalIncrease,
 	}
+	err = resp.Sign(n.key)
+	require.NoError(t, err)
+
+	expected, err := shared.EncodeResponse(shared.JSONCodec, resp)
+	require.NoError(t, err)
+	requireSent(t, n, expected)
+}
+
+func TestProvider_Lifecycle(t *testing.T) {
+	n := newMockNetwork()
+	n.sending = make(chan struct{})
+	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
+	err := p.Start(context.Background())
+	require.NoError(t, err)
+
+	err = p.Start(context.Background())
+	require.Equal(t, ErrAlreadyStarted, err)
+
+	b := block.NewBlock([]byte("noot"))
+	err = p.store.(*mockRetrievalProviderStore).bs.Put(b)
+	require.NoError(t, err)
+
+	query := &shared.Query{
+		ID: shared.NewQueryID(),
+		Params: shared.Params{
+			PayloadCID: b.Cid(),
+		},
+		ClientAddrs: []string{testMultiAddrStr},
+	}
+
+	bz, err := query.Marshal()
+	require.NoError(t, err)
+
+	n.msgs <- newTestMessage(shared.RetrievalProtocolID, bz)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&n.inflight) == 1
+	}, time.Second, time.Millisecond)
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- p.Stop(context.Background())
+	}()
+
+	// the in-flight response is sent before the network is stopped
+	select {
+	case <-stopped:
+		t.Fatal("provider stopped before sending in-flight response")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(n.sending)
+	require.NoError(t, <-stopped)
+	require.Len(t, n.sentMessages(), 1)
+	require.True(t, n.stopped)
+
+	// queries are no longer handled
+	select {
+	case n.msgs <- newTestMessage(shared.RetrievalProtocolID, bz):
+		t.Fatal("provider handled query after being stopped")
+	case <-time.After(time.Millisecond * 10):
+	}
+
+	err = p.Start(context.Background())
+	require.Equal(t, ErrStopped, err)
+}
+
+func TestProvider_StopTimeout(t *testing.T) {
+	n := newMockNetwork()
+	n.sending = make(chan struct{})
+	defer close(n.sending)
+
+	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
+	err := p.Start(context.Background())
+	require.NoError(t, err)
+
+	b := block.NewBlock([]byte("noot"))
+	err = p.store.(*mockRetrievalProviderStore).bs.Put(b)
+	require.NoError(t, err)
+
+	query := &shared.Query{
+		ID: shared.NewQueryID(),
+		Params: shared.Params{
+			PayloadCID: b.Cid(),
+		},
+		ClientAddrs: []string{testMultiAddrStr},
+	}
 
-	expected, err := resp.Marshal()
+	bz, err := query.Marshal()
 	require.NoError(t, err)
-	time.Sleep(time.Millisecond * 10)
-	require.Equal(t, expected, n.sent)
+
+	n.msgs <- newTestMessage(shared.RetrievalProtocolID, bz)
+
+	// the network is stopped even if the response can't be sent in time
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err = p.Stop(ctx)
+	require.NoError(t, err)
+	require.True(t, n.stopped)
+}
+
+func newTestQueryMessage(t *testing.T, payloadCID cid.Cid) *shared.Message {
+	query := &shared.Query{
+		ID: shared.NewQueryID(),
+		Params: shared.Params{
+			PayloadCID: payloadCID,
+		},
+		ClientAddrs: []string{testMultiAddrStr},
+	}
+
+	bz, err := query.Marshal()
+	require.NoError(t, err)
+	return newTestMessage(shared.RetrievalProtocolID, bz)
+}
+
+func TestProvider_Workers(t *testing.T) {
+	n := newMockNetwork()
+	n.sending = make(chan struct{})
+	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
+	p.SetWorkers(2)
+	err := p.Start(context.Background())
+	require.NoError(t, err)
+
+	defer func() {
+		close(n.sending)
+		err = p.Stop(context.Background())
+		require.NoError(t, err)
+	}()
+
+	b := block.NewBlock([]byte("noot"))
+	err = p.store.(*mockRetrievalProviderStore).bs.Put(b)
+	require.NoError(t, err)
+
+	// a slow client doesn't stop the next query from being answered
+	n.msgs <- newTestQueryMessage(t, b.Cid())
+	n.msgs <- newTestQueryMessage(t, b.Cid())
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&n.inflight) == 2
+	}, time.Second, time.Millisecond)
+}
+
+func TestProvider_QueuePolicy(t *testing.T) {
+	for _, policy := range []QueuePolicy{QueueDrop, QueueBlock} {
+		t.Run(policy.String(), func(t *testing.T) {
+			n := newMockNetwork()
+			n.sending = make(chan struct{})
+			p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
+			p.SetWorkers(1)
+			p.SetQueue(1, policy)
+			err := p.Start(context.Background())
+			require.NoError(t, err)
+
+			defer func() {
+				err = p.Stop(context.Background())
+				require.NoError(t, err)
+			}()
+			defer close(n.sending)
+
+			b := block.NewBlock([]byte("noot"))
+			err = p.store.(*mockRetrievalProviderStore).bs.Put(b)
+			require.NoError(t, err)
+
+			// the first query occupies the worker, and the second fills the queue
+			n.msgs <- newTestQueryMessage(t, b.Cid())
+			require.Eventually(t, func() bool {
+				return atomic.LoadInt32(&n.inflight) == 1
+			}, time.Second, time.Millisecond)
+			n.msgs <- newTestQueryMessage(t, b.Cid())
+			n.msgs <- newTestQueryMessage(t, b.Cid())
+
+			select {
+			case n.msgs <- newTestQueryMessage(t, b.Cid()):
+				require.Equal(t, QueueDrop, policy)
+				require.Eventually(t, func() bool {
+					return p.DroppedQueries() == 2
+				}, time.Second, time.Millisecond)
+			case <-time.After(time.Millisecond * 50):
+				require.Equal(t, QueueBlock, policy)
+				require.Equal(t, uint64(0), p.DroppedQueries())
+			}
+		})
+	}
+}
+
+func TestProvider_RateLimit(t *testing.T) {
+	n := newMockNetwork()
+	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
+	p.SetRateLimit(0.001, 2)
+	err := p.Start(context.Background())
+	require.NoError(t, err)
+
+	defer func() {
+		err = p.Stop(context.Background())
+		require.NoError(t, err)
+	}()
+
+	b := block.NewBlock([]byte("noot"))
+	err = p.store.(*mockRetrievalProviderStore).bs.Put(b)
+	require.NoError(t, err)
+
+	// queries beyond the burst from the same gossip source are throttled
+	for i := 0; i < 3; i++ {
+		msg := newTestQueryMessage(t, b.Cid())
+		msg.From = "source"
+		n.msgs <- msg
+	}
+	require.Eventually(t, func() bool {
+		return p.ThrottledQueries() == 1
+	}, time.Second, time.Millisecond)
+
+	// as are queries from the same client, whatever their gossip source; the client has used
+	// its burst on the queries that passed the source limit
+	msg := newTestQueryMessage(t, b.Cid())
+	msg.From = "other source"
+	n.msgs <- msg
+	require.Eventually(t, func() bool {
+		return p.ThrottledQueries() == 2
+	}, time.Second, time.Millisecond)
+}
+
+func TestProvider_RateLimit_NoClientAddrs(t *testing.T) {
+	n := newMockNetwork()
+	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
+	p.SetRateLimit(0.001, 1)
+	var handled int32
+	p.SubscribeToQueries(func(shared.Query) {
+		atomic.AddInt32(&handled, 1)
+	})
+	err := p.Start(context.Background())
+	require.NoError(t, err)
+
+	defer func() {
+		err = p.Stop(context.Background())
+		require.NoError(t, err)
+	}()
+
+	b := block.NewBlock([]byte("noot"))
+	err = p.store.(*mockRetrievalProviderStore).bs.Put(b)
+	require.NoError(t, err)
+
+	// queries without a client are limited per publisher, rather than sharing a single client bucket
+	for _, from := range []peer.ID{"source", "other source", "source"} {
+		query := &shared.Query{
+			ID:     shared.NewQueryID(),
+			Params: shared.Params{PayloadCID: b.Cid()},
+		}
+		bz, err := query.Marshal()
+		require.NoError(t, err)
+
+		msg := newTestMessage(shared.RetrievalProtocolID, bz)
+		msg.From = from
+		n.msgs <- msg
+	}
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&handled) == 2 && p.ThrottledQueries() == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestProvider_ResponseTimeout(t *testing.T) {
+	n := newMockNetwork()
+	n.sending = make(chan struct{})
+	defer close(n.sending)
+
+	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
+	p.SetResponseTimeout(time.Millisecond * 10)
+	err := p.Start(context.Background())
+	require.NoError(t, err)
+
+	defer func() {
+		err = p.Stop(context.Background())
+		require.NoError(t, err)
+	}()
+
+	b := block.NewBlock([]byte("noot"))
+	err = p.store.(*mockRetrievalProviderStore).bs.Put(b)
+	require.NoError(t, err)
+
+	// the response is abandoned once the timeout expires
+	n.msgs <- newTestQueryMessage(t, b.Cid())
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&n.inflight) == 1
+	}, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&n.inflight) == 0
+	}, time.Second, time.Millisecond)
+	require.Empty(t, n.sentMessages())
+}
+
+func TestProvider_Constraints(t *testing.T) {
+	n := newMockNetwork()
+	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
+	err := p.Start(context.Background())
+	require.NoError(t, err)
+
+	defer func() {
+		err = p.Stop(context.Background())
+		require.NoError(t, err)
+	}()
+
+	b := block.NewBlock([]byte("noot"))
+	err = p.store.(*mockRetrievalProviderStore).bs.Put(b)
+	require.NoError(t, err)
+
+	maxPrice := big.Sub(DefaultPricePerByte, big.NewInt(1))
+	query := &shared.Query{
+		ID: shared.NewQueryID(),
+		Params: shared.Params{
+			PayloadCID: b.Cid(),
+		},
+		ClientAddrs: []string{testMultiAddrStr},
+		Constraints: &shared.Constraints{MaxPricePerByte: &maxPrice},
+	}
+
+	bz, err := query.Marshal()
+	require.NoError(t, err)
+
+	// provider's price is too high, so it doesn't respond
+	n.msgs <- newTestMessage(shared.RetrievalProtocolID, bz)
+	require.Never(t, func() bool {
+		return len(n.sentMessages()) > 0
+	}, time.Millisecond*50, time.Millisecond)
+
+	// provider's price is within the client's max
+	p.SetPricePerByte(maxPrice)
+	n.msgs <- newTestMessage(shared.RetrievalProtocolID, bz)
+
+	resp := &shared.QueryResponse{
+		ID:                      query.ID,
+		Params:                  query.Params,
+		Provider:                n.PeerID(),
+		PricePerByte:            maxPrice,
+		PaymentInterval:         DefaultPaymentInterval,
+		PaymentIntervalIncrease: DefaultPaymentIntervalIncrease,
+	}
+	err = resp.Sign(n.key)
+	require.NoError(t, err)
+
+	expected, err := shared.EncodeResponse(shared.JSONCodec, resp)
+	require.NoError(t, err)
+	requireSent(t, n, expected)
 }
 
 func TestProvider_SetPricing(t *testing.T) {
 	n := newMockNetwork()
 	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
-	err := p.Start()
+	err := p.Start(context.Background())
 	require.NoError(t, err)
 
 	price := abi.NewTokenAmount(10)
@@ -156,9 +562,10 @@ func TestProvider_SetPricing(t *testing.T) {
 	interval := uint64(33)
 	increase := uint64(44)
 	p.SetPaymentInterval(interval, increase)
+	require.Equal(t, Terms{PricePerByte: price, PaymentInterval: interval, PaymentIntervalIncrease: increase}, p.Terms())
 
 	defer func() {
-		err = p.Stop()
+		err = p.Stop(context.Background())
 		require.NoError(t, err)
 	}()
 
@@ -169,6 +576,7 @@ func TestProvider_SetPricing(t *testing.T) {
 	require.NoError(t, err)
 
 	query := &shared.Query{
+		ID: shared.NewQueryID(),
 		Params: shared.Params{
 			PayloadCID: testCid,
 		},
@@ -178,20 +586,152 @@ func TestProvider_SetPricing(t *testing.T) {
 	bz, err := query.Marshal()
 	require.NoError(t, err)
 
-	n.msgs <- bz
+	n.msgs <- newTestMessage(shared.RetrievalProtocolID, bz)
 
 	resp := &shared.QueryResponse{
+		ID:                      query.ID,
 		Params:                  query.Params,
 		Provider:                n.PeerID(),
 		PricePerByte:            price,
 		PaymentInterval:         interval,
 		PaymentIntervalIncrease: increase,
 	}
+	err = resp.Sign(n.key)
+	require.NoError(t, err)
 
-	expected, err := resp.Marshal()
+	expected, err := shared.EncodeResponse(shared.JSONCodec, resp)
 	require.NoError(t, err)
-	time.Sleep(time.Millisecond * 10)
-	require.Equal(t, expected, n.sent)
+	requireSent(t, n, expected)
+}
+
+func TestProvider_ResponseCBOR(t *testing.T) {
+	n := newMockNetwork()
+	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
+	err := p.Start(context.Background())
+	require.NoError(t, err)
+
+	defer func() {
+		err = p.Stop(context.Background())
+		require.NoError(t, err)
+	}()
+
+	b := block.NewBlock([]byte("noot"))
+	testCid := b.Cid()
+
+	err = p.store.(*mockRetrievalProviderStore).bs.Put(b)
+	require.NoError(t, err)
+
+	query := &shared.Query{
+		ID: shared.NewQueryID(),
+		Params: shared.Params{
+			PayloadCID: testCid,
+		},
+		ClientAddrs: []string{testMultiAddrStr},
+	}
+
+	// query is received on the CBOR topic and should be answered with CBOR
+	bz, err := shared.EncodeQuery(shared.CBORCodec, query)
+	require.NoError(t, err)
+
+	n.msgs <- newTestMessage(shared.CBORRetrievalProtocolID, bz)
+
+	resp := &shared.QueryResponse{
+		ID:                      query.ID,
+		Params:                  query.Params,
+		Provider:                n.PeerID(),
+		PricePerByte:            DefaultPricePerByte,
+		PaymentInterval:         DefaultPaymentInterval,
+		PaymentIntervalIncrease: DefaultPaymentIntervalIncrease,
+	}
+	err = resp.Sign(n.key)
+	require.NoError(t, err)
+
+	expected, err := shared.EncodeResponse(shared.CBORCodec, resp)
+	require.NoError(t, err)
+	sent := requireSent(t, n, expected)
+	require.Equal(t, shared.CBORResponseProtocolID, sent.protocol)
+}
+
+type mockStatusStore struct {
+	availability Availability
+}
+
+func (s *mockStatusStore) Has(params shared.Params) (bool, error) {
+	return s.availability.Status == shared.QueryResponseAvailable, nil
+}
+
+func (s *mockStatusStore) Status(params shared.Params) (Availability, error) {
+	return s.availability, nil
+}
+
+func TestProvider_Status(t *testing.T) {
+	testCid := block.NewBlock([]byte("noot")).Cid()
+
+	testCases := []struct {
+		name           string
+		availability   Availability
+		priceOnRequest bool
+		expected       *shared.QueryResponse
+	}{
+		{
+			name:         "available later",
+			availability: Availability{Status: shared.QueryResponseAvailableLater, ETA: time.Hour},
+			expected: &shared.QueryResponse{
+				Status:                  shared.QueryResponseAvailableLater,
+				ETA:                     3600,
+				PricePerByte:            DefaultPricePerByte,
+				PaymentInterval:         DefaultPaymentInterval,
+				PaymentIntervalIncrease: DefaultPaymentIntervalIncrease,
+			},
+		},
+		{
+			name:           "price on request",
+			availability:   Availability{Status: shared.QueryResponseAvailable},
+			priceOnRequest: true,
+			expected: &shared.QueryResponse{
+				Status:       shared.QueryResponsePriceOnRequest,
+				PricePerByte: big.Zero(),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newMockNetwork()
+			p := NewProvider(n, &mockStatusStore{availability: tc.availability}, cache.NewMockCache(testCacheSize))
+			p.SetPriceOnRequest(tc.priceOnRequest)
+			err := p.Start(context.Background())
+			require.NoError(t, err)
+
+			defer func() {
+				err = p.Stop(context.Background())
+				require.NoError(t, err)
+			}()
+
+			query := &shared.Query{
+				ID: shared.NewQueryID(),
+				Params: shared.Params{
+					PayloadCID: testCid,
+				},
+				ClientAddrs: []string{testMultiAddrStr},
+			}
+
+			bz, err := query.Marshal()
+			require.NoError(t, err)
+			n.msgs <- newTestMessage(shared.RetrievalProtocolID, bz)
+
+			resp := tc.expected
+			resp.ID = query.ID
+			resp.Params = query.Params
+			resp.Provider = n.PeerID()
+			err = resp.Sign(n.key)
+			require.NoError(t, err)
+
+			expected, err := shared.EncodeResponse(shared.JSONCodec, resp)
+			require.NoError(t, err)
+			requireSent(t, n, expected)
+		})
+	}
 }
 
 type mockQueryHandler struct {
@@ -211,11 +751,11 @@ func (h *mockQueryHandler) handleQuery(query shared.Query) {
 func TestSubscribe(t *testing.T) {
 	n := newMockNetwork()
 	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
-	err := p.Start()
+	err := p.Start(context.Background())
 	require.NoError(t, err)
 
 	defer func() {
-		err = p.Stop()
+		err = p.Stop(context.Background())
 		require.NoError(t, err)
 	}()
 
@@ -227,6 +767,7 @@ func TestSubscribe(t *testing.T) {
 	b := block.NewBlock([]byte("noot"))
 	testCid := b.Cid()
 	query := &shared.Query{
+		ID: shared.NewQueryID(),
 		Params: shared.Params{
 			PayloadCID: testCid,
 		},
@@ -236,7 +777,7 @@ func TestSubscribe(t *testing.T) {
 	// send query to provider
 	bz, err := query.Marshal()
 	require.NoError(t, err)
-	n.msgs <- bz
+	n.msgs <- newTestMessage(shared.RetrievalProtocolID, bz)
 
 	select {
 	case q := <-h.received:
@@ -247,7 +788,7 @@ func TestSubscribe(t *testing.T) {
 
 	// unsubscribe and make sure no queries are received
 	unsubscribe()
-	n.msgs <- bz
+	n.msgs <- newTestMessage(shared.RetrievalProtocolID, bz)
 
 	select {
 	case <-h.received:
@@ -255,3 +796,43 @@ func TestSubscribe(t *testing.T) {
 	default:
 	}
 }
+
+func TestProvider_InvalidQuerySignature(t *testing.T) {
+	n := newMockNetwork()
+	p := NewProvider(n, newTestRetrievalProviderStore(), cache.NewMockCache(testCacheSize))
+	err := p.Start(context.Background())
+	require.NoError(t, err)
+
+	defer func() {
+		err = p.Stop(context.Background())
+		require.NoError(t, err)
+	}()
+
+	h := newMockQueryHandler()
+	unsubscribe := p.SubscribeToQueries(h.handleQuery)
+	defer unsubscribe()
+
+	// sign the query with a key that doesn't own the client addrs
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+
+	query := &shared.Query{
+		ID: shared.NewQueryID(),
+		Params: shared.Params{
+			PayloadCID: block.NewBlock([]byte("noot")).Cid(),
+		},
+		ClientAddrs: []string{testMultiAddrStr},
+	}
+	err = query.Sign(key)
+	require.NoError(t, err)
+
+	bz, err := query.Marshal()
+	require.NoError(t, err)
+	n.msgs <- newTestMessage(shared.RetrievalProtocolID, bz)
+
+	select {
+	case <-h.received:
+		t.Fatal("received query with invalid signature")
+	case <-time.After(time.Millisecond * 100):
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package provider
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultWorkers is the default number of gossiped queries handled at once
+var DefaultWorkers = 8
+
+// DefaultQueueSize is the default number of gossiped queries waiting for a worker
+var DefaultQueueSize = 64
+
+// DefaultResponseTimeout is the default time allowed to connect to a client and send it a response
+var DefaultResponseTimeout = 10 * time.Second
+
+// QueuePolicy determines what happens to a gossiped query when the queue of queries waiting for a worker is full
+type QueuePolicy int
+
+const (
+	// QueueDrop drops the query, so queries keep being read from the network while the workers are busy
+	QueueDrop QueuePolicy = iota
+
+	// QueueBlock waits for room in the queue, applying backpressure to the network
+	QueueBlock
+)
+
+// String returns the name of the policy
+func (q QueuePolicy) String() string {
+	switch q {
+	case QueueDrop:
+		return "drop"
+	case QueueBlock:
+		return "block"
+	default:
+		return fmt.Sprintf("QueuePolicy(%d)", int(q))
+	}
+}
+
+// ParseQueuePolicy returns the policy with the given name
+func ParseQueuePolicy(name string) (QueuePolicy, error) {
+	switch name {
+	case "drop":
+		return QueueDrop, nil
+	case "block":
+		return QueueBlock, nil
+	default:
+		return 0, fmt.Errorf("unknown queue policy %q, must be drop or block", name)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package provider
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// DefaultRateLimit is the default number of queries per second handled from each peer
+var DefaultRateLimit = 10.0
+
+// DefaultRateBurst is the default number of queries a peer can send at once before being throttled
+var DefaultRateBurst = 50
+
+// rateLimiter is a token bucket per peer. Each bucket holds up to burst tokens and refills at rate tokens
+// per second; a query is allowed if it can take a token from its peer's bucket.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	lock      sync.Mutex
+	buckets   map[peer.ID]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[peer.ID]*bucket),
+	}
+}
+
+// allow takes a token from the peer's bucket, returning false if it is empty
+func (r *rateLimiter) allow(p peer.ID) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.now()
+	r.sweep(now)
+
+	b, has := r.buckets[p]
+	if !has {
+		b = &bucket{tokens: r.burst, last: now}
+		r.buckets[p] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * r.rate
+	if b.tokens > r.burst {
+		b.tokens = r.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// sweep removes the buckets that have refilled completely, as they are the same as new buckets.
+// It runs at most once per refill period, so the number of buckets is bounded by the number of peers
+// seen in the last two periods.
+func (r *rateLimiter) sweep(now time.Time) {
+	refill := time.Duration(r.burst / r.rate * float64(time.Second))
+	if now.Sub(r.lastSweep) < refill {
+		return
+	}
+	r.lastSweep = now
+
+	for p, b := range r.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(r.buckets, p)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	r := newRateLimiter(2, 3)
+	r.now = func() time.Time { return now }
+
+	// the burst is allowed at once, then the bucket is empty
+	for i := 0; i < 3; i++ {
+		require.True(t, r.allow("a"))
+	}
+	require.False(t, r.allow("a"))
+
+	// each peer has its own bucket
+	require.True(t, r.allow("b"))
+
+	// tokens refill at the rate, up to the burst
+	now = now.Add(500 * time.Millisecond)
+	require.True(t, r.allow("a"))
+	require.False(t, r.allow("a"))
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		require.True(t, r.allow("a"))
+	}
+	require.False(t, r.allow("a"))
+}
+
+func TestRateLimiter_Sweep(t *testing.T) {
+	now := time.Now()
+	r := newRateLimiter(1, 2)
+	r.now = func() time.Time { return now }
+
+	for _, p := range []peer.ID{"a", "b", "c"} {
+		require.True(t, r.allow(p))
+	}
+	require.Len(t, r.buckets, 3)
+
+	// once the buckets have refilled completely they're removed, and recreated when needed
+	now = now.Add(2 * time.Second)
+	require.True(t, r.allow("a"))
+	require.Len(t, r.buckets, 1)
+}
@@ -4,9 +4,34 @@
 package provider
 
 import (
+	"time"
+
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/ipfs/go-cid"
 )
 
 type RetrievalProviderStore interface {
 	Has(params shared.Params) (bool, error)
 }
+
+// Availability describes whether a provider can serve the requested data
+type Availability struct {
+	Status shared.QueryResponseStatus
+	ETA    time.Duration // Time until the data is available, for QueryResponseAvailableLater
+}
+
+// RetrievalProviderStatusStore is an optional extension of RetrievalProviderStore for stores that can
+// report availability in more detail than Has, for example data that must be unsealed before retrieval.
+// If the provider's store implements it, Status is used instead of Has.
+type RetrievalProviderStatusStore interface {
+	RetrievalProviderStore
+	Status(params shared.Params) (Availability, error)
+}
+
+// RetrievalProviderCIDStore is an optional extension of RetrievalProviderStore for stores that can list
+// the payload and piece CIDs they hold. The provider's store must implement it to advertise its CIDs
+// through content routing.
+type RetrievalProviderCIDStore interface {
+	RetrievalProviderStore
+	CIDs() []cid.Cid
+}
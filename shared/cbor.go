@@ -0,0 +1,197 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package shared
+
+import (
+	"fmt"
+	"io"
+
+	cbg "github.com/whyrusleeping/cbor-gen"
+	xerrors "golang.org/x/xerrors"
+)
+
+// The CBOR encoders for Query are written by hand, as cbor-gen does not support slices of strings.
+// They follow the same tuple encoding as the generated encoders in cbor_gen.go.
+
+var lengthBufQuery = []byte{134}
+
+// MarshalCBOR writes the CBOR tuple encoding of the Query to w
+func (t *Query) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write(lengthBufQuery); err != nil {
+		return err
+	}
+
+	scratch := make([]byte, 9)
+
+	// t.ID (shared.QueryID) (string)
+	if err := writeString(scratch, w, "t.ID", string(t.ID)); err != nil {
+		return err
+	}
+
+	// t.Params (shared.Params) (struct)
+	if err := t.Params.MarshalCBOR(w); err != nil {
+		return err
+	}
+
+	// t.ClientAddrs ([]string) (slice)
+	if len(t.ClientAddrs) > cbg.MaxLength {
+		return xerrors.Errorf("Slice value in field t.ClientAddrs was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajArray, uint64(len(t.ClientAddrs))); err != nil {
+		return err
+	}
+	for _, v := range t.ClientAddrs {
+		if err := writeString(scratch, w, "t.ClientAddrs", v); err != nil {
+			return err
+		}
+	}
+
+	// t.Constraints (shared.Constraints) (struct)
+	if err := t.Constraints.MarshalCBOR(w); err != nil {
+		return err
+	}
+
+	// t.Key ([]uint8) (slice)
+	if err := writeByteArray(scratch, w, "t.Key", t.Key); err != nil {
+		return err
+	}
+
+	// t.Signature ([]uint8) (slice)
+	return writeByteArray(scratch, w, "t.Signature", t.Signature)
+}
+
+// UnmarshalCBOR reads a CBOR tuple encoded Query from r
+func (t *Query) UnmarshalCBOR(r io.Reader) error {
+	*t = Query{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray {
+		return fmt.Errorf("cbor input should be of type array")
+	}
+
+	if extra != 6 {
+		return fmt.Errorf("cbor input had wrong number of fields")
+	}
+
+	// t.ID (shared.QueryID) (string)
+	sval, err := cbg.ReadStringBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	t.ID = QueryID(sval)
+
+	// t.Params (shared.Params) (struct)
+	if err := t.Params.UnmarshalCBOR(br); err != nil {
+		return xerrors.Errorf("unmarshaling t.Params: %w", err)
+	}
+
+	// t.ClientAddrs ([]string) (slice)
+	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("t.ClientAddrs: array too large (%d)", extra)
+	}
+	if maj != cbg.MajArray {
+		return fmt.Errorf("expected cbor array")
+	}
+
+	if extra > 0 {
+		t.ClientAddrs = make([]string, extra)
+	}
+	for i := 0; i < int(extra); i++ {
+		t.ClientAddrs[i], err = cbg.ReadStringBuf(br, scratch)
+		if err != nil {
+			return xerrors.Errorf("reading t.ClientAddrs[%d]: %w", i, err)
+		}
+	}
+
+	// t.Constraints (shared.Constraints) (struct)
+	pb, err := br.PeekByte()
+	if err != nil {
+		return err
+	}
+	if pb == cbg.CborNull[0] {
+		var nbuf [1]byte
+		if _, err := br.Read(nbuf[:]); err != nil {
+			return err
+		}
+	} else {
+		t.Constraints = new(Constraints)
+		if err := t.Constraints.UnmarshalCBOR(br); err != nil {
+			return xerrors.Errorf("unmarshaling t.Constraints pointer: %w", err)
+		}
+	}
+
+	// t.Key ([]uint8) (slice)
+	t.Key, err = readByteArray(br, scratch, "t.Key")
+	if err != nil {
+		return err
+	}
+
+	// t.Signature ([]uint8) (slice)
+	t.Signature, err = readByteArray(br, scratch, "t.Signature")
+	return err
+}
+
+func writeString(scratch []byte, w io.Writer, field, s string) error {
+	if len(s) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field %s was too long", field)
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len(s))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+func writeByteArray(scratch []byte, w io.Writer, field string, bz []byte) error {
+	if len(bz) > cbg.ByteArrayMaxLen {
+		return xerrors.Errorf("Byte array in field %s was too long", field)
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajByteString, uint64(len(bz))); err != nil {
+		return err
+	}
+	_, err := w.Write(bz)
+	return err
+}
+
+func readByteArray(br cbg.BytePeeker, scratch []byte, field string) ([]byte, error) {
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return nil, err
+	}
+
+	if extra > cbg.ByteArrayMaxLen {
+		return nil, fmt.Errorf("%s: byte array too large (%d)", field, extra)
+	}
+	if maj != cbg.MajByteString {
+		return nil, fmt.Errorf("expected byte array")
+	}
+
+	if extra == 0 {
+		return nil, nil
+	}
+
+	bz := make([]byte, extra)
+	if _, err := io.ReadFull(br, bz); err != nil {
+		return nil, err
+	}
+	return bz, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// Codec encodes and decodes queries and responses for a version of the wire protocol.
+// Encoded messages are self-delimiting, so they can be read directly off a stream.
+type Codec interface {
+	EncodeQuery(w io.Writer, q *Query) error
+	DecodeQuery(r io.Reader, q *Query) error
+	EncodeResponse(w io.Writer, resp *QueryResponse) error
+	DecodeResponse(r io.Reader, resp *QueryResponse) error
+}
+
+// JSONCodec encodes messages as newline-terminated JSON
+var JSONCodec Codec = jsonCodec{}
+
+// CBORCodec encodes messages as CBOR tuples
+var CBORCodec Codec = cborCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) EncodeQuery(w io.Writer, q *Query) error {
+	return json.NewEncoder(w).Encode(q)
+}
+
+func (jsonCodec) DecodeQuery(r io.Reader, q *Query) error {
+	return json.NewDecoder(r).Decode(q)
+}
+
+func (jsonCodec) EncodeResponse(w io.Writer, resp *QueryResponse) error {
+	return json.NewEncoder(w).Encode(resp)
+}
+
+func (jsonCodec) DecodeResponse(r io.Reader, resp *QueryResponse) error {
+	return json.NewDecoder(r).Decode(resp)
+}
+
+type cborCodec struct{}
+
+func (cborCodec) EncodeQuery(w io.Writer, q *Query) error {
+	return q.MarshalCBOR(w)
+}
+
+func (cborCodec) DecodeQuery(r io.Reader, q *Query) error {
+	return q.UnmarshalCBOR(r)
+}
+
+func (cborCodec) EncodeResponse(w io.Writer, resp *QueryResponse) error {
+	return resp.MarshalCBOR(w)
+}
+
+func (cborCodec) DecodeResponse(r io.Reader, resp *QueryResponse) error {
+	return resp.UnmarshalCBOR(r)
+}
+
+// EncodeQuery returns the query encoded with the given codec
+func EncodeQuery(c Codec, q *Query) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := c.EncodeQuery(buf, q)
+	return buf.Bytes(), err
+}
+
+// DecodeQuery decodes a query from bz with the given codec
+func DecodeQuery(c Codec, bz []byte) (*Query, error) {
+	q := new(Query)
+	err := c.DecodeQuery(bytes.NewReader(bz), q)
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// EncodeResponse returns the response encoded with the given codec
+func EncodeResponse(c Codec, resp *QueryResponse) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := c.EncodeResponse(buf, resp)
+	return buf.Bytes(), err
+}
+
+// DecodeResponse decodes a response from bz with the given codec
+func DecodeResponse(c Codec, bz []byte) (*QueryResponse, error) {
+	resp := new(QueryResponse)
+	err := c.DecodeResponse(bytes.NewReader(bz), resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package shared
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecs(t *testing.T) {
+	key, id := newTestKey(t)
+	pieceCID := testCid
+
+	query := &Query{
+		ID: NewQueryID(),
+		Params: Params{
+			PayloadCID: testCid,
+			PieceCID:   &pieceCID,
+		},
+		ClientAddrs: []string{"/ip4/1.2.3.4/tcp/5678/p2p/" + id.String()},
+	}
+
+	maxPrice := abi.NewTokenAmount(3)
+	constrained := *query
+	constrained.Constraints = &Constraints{
+		MaxPricePerByte:            &maxPrice,
+		MinPaymentInterval:         1 << 10,
+		MaxPaymentIntervalIncrease: 1 << 20,
+	}
+	err := constrained.Sign(key)
+	require.NoError(t, err)
+
+	err = query.Sign(key)
+	require.NoError(t, err)
+
+	resp := &QueryResponse{
+		ID:                      query.ID,
+		Params:                  query.Params,
+		Status:                  QueryResponseAvailable,
+		Provider:                id,
+		PricePerByte:            abi.NewTokenAmount(2),
+		PaymentInterval:         1 << 20,
+		PaymentIntervalIncrease: 1 << 20,
+	}
+	err = resp.Sign(key)
+	require.NoError(t, err)
+
+	for _, v := range Versions {
+		for _, q := range []*Query{query, &constrained} {
+			bz, err := EncodeQuery(v.Codec, q)
+			require.NoError(t, err)
+			decoded, err := DecodeQuery(v.Codec, bz)
+			require.NoError(t, err)
+			require.Equal(t, q, decoded)
+			require.NoError(t, decoded.Verify())
+		}
+
+		bz, err := EncodeResponse(v.Codec, resp)
+		require.NoError(t, err)
+		decodedResp, err := DecodeResponse(v.Codec, bz)
+		require.NoError(t, err)
+		require.Equal(t, resp, decodedResp)
+		require.NoError(t, decodedResp.Verify())
+	}
+}
+
+func TestVersionFor(t *testing.T) {
+	for _, v := range Versions {
+		for _, id := range []core.ProtocolID{v.Topic, v.Response, v.Query} {
+			found, ok := VersionFor(id)
+			require.True(t, ok, id)
+			require.Equal(t, v.Topic, found.Topic)
+		}
+	}
+
+	_, ok := VersionFor("/some/other/protocol")
+	require.False(t, ok)
+
+	require.Equal(t, QueryProtocolID, QueryProtocols(JSONVersion)[0])
+	require.Equal(t, len(Versions), len(QueryProtocols(JSONVersion)))
+}
@@ -0,0 +1,18 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package shared
+
+import (
+	"errors"
+)
+
+// ErrUnsigned is returned when verifying a message that has no signature
+var ErrUnsigned = errors.New("message is not signed")
+
+// ErrInvalidSignature is returned when a message's signature does not match its contents and key
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// ErrSignerMismatch is returned when a message is signed by a key that does not belong to the
+// peer the message claims to be from
+var ErrSignerMismatch = errors.New("message signer does not match sender")
@@ -0,0 +1,16 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package shared
+
+import (
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Message is a message received over pubsub
+type Message struct {
+	Topic core.ProtocolID // Topic the message was received on, identifies the protocol Version
+	From  peer.ID         // Peer that published the message
+	Data  []byte
+}
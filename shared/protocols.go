@@ -9,3 +9,63 @@ import (
 
 var RetrievalProtocolID core.ProtocolID = "/fil/secondary-retrieval/0.0.1"
 var ResponseProtocolID core.ProtocolID = "/fil/secondary-retrieval/response/0.0.1"
+
+// QueryProtocolID is used by clients to query a known provider directly.
+// The provider writes its QueryResponse back on the same stream.
+var QueryProtocolID core.ProtocolID = "/fil/secondary-retrieval/query/0.0.1"
+
+// Version 0.1.0 of the protocol encodes messages as CBOR instead of JSON
+var CBORRetrievalProtocolID core.ProtocolID = "/fil/secondary-retrieval/0.1.0"
+var CBORResponseProtocolID core.ProtocolID = "/fil/secondary-retrieval/response/0.1.0"
+var CBORQueryProtocolID core.ProtocolID = "/fil/secondary-retrieval/query/0.1.0"
+
+// Version is a version of the wire protocol. It consists of the gossip topic queries are published on,
+// the protocols used for responses and direct queries, and the codec messages are encoded with.
+type Version struct {
+	Topic    core.ProtocolID
+	Response core.ProtocolID
+	Query    core.ProtocolID
+	Codec    Codec
+}
+
+// JSONVersion is the original JSON-encoded protocol, version 0.0.1
+var JSONVersion = Version{
+	Topic:    RetrievalProtocolID,
+	Response: ResponseProtocolID,
+	Query:    QueryProtocolID,
+	Codec:    JSONCodec,
+}
+
+// CBORVersion is the CBOR-encoded protocol, version 0.1.0
+var CBORVersion = Version{
+	Topic:    CBORRetrievalProtocolID,
+	Response: CBORResponseProtocolID,
+	Query:    CBORQueryProtocolID,
+	Codec:    CBORCodec,
+}
+
+// Versions are the supported protocol versions, most preferred first.
+// Clients and providers speak all of them side by side while peers migrate.
+var Versions = []Version{CBORVersion, JSONVersion}
+
+// VersionFor returns the Version that uses the given protocol ID as its topic, response or query protocol
+func VersionFor(id core.ProtocolID) (Version, bool) {
+	for _, v := range Versions {
+		if v.Topic == id || v.Response == id || v.Query == id {
+			return v, true
+		}
+	}
+	return Version{}, false
+}
+
+// QueryProtocols returns the direct query protocols of the given version followed by those of
+// all other supported versions, in order of preference
+func QueryProtocols(preferred Version) []core.ProtocolID {
+	ids := []core.ProtocolID{preferred.Query}
+	for _, v := range Versions {
+		if v.Query != preferred.Query {
+			ids = append(ids, v.Query)
+		}
+	}
+	return ids
+}
@@ -4,10 +4,13 @@
 package shared
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 
 	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/peer"
 )
@@ -33,10 +36,64 @@ func (p *Params) MustString() string {
 	return string(bz)
 }
 
+// QueryID uniquely identifies a query. Providers echo it back in their responses
+// so clients can correlate responses with individual queries.
+type QueryID string
+
+// NewQueryID returns a random QueryID
+// It panics if it fails to read from the system's random source
+func NewQueryID() QueryID {
+	bz := make([]byte, 16)
+	_, err := rand.Read(bz)
+	if err != nil {
+		panic(err)
+	}
+	return QueryID(hex.EncodeToString(bz))
+}
+
+// Constraints are optional limits on the terms a client will accept.
+// Providers whose terms do not satisfy them do not respond to gossiped queries.
+type Constraints struct {
+	MaxPricePerByte            *big.Int `json:"maxPricePerByte,omitempty"`            // Highest acceptable price per byte, if set
+	MinPaymentInterval         uint64   `json:"minPaymentInterval,omitempty"`         // Lowest acceptable payment interval
+	MaxPaymentIntervalIncrease uint64   `json:"maxPaymentIntervalIncrease,omitempty"` // Highest acceptable payment interval increase, 0 for no limit
+}
+
+// Accepts returns whether the response's terms satisfy the constraints.
+// Responses that do not include terms, ie. with status unavailable or price on request, are always accepted,
+// as are all responses if the constraints are nil.
+func (c *Constraints) Accepts(resp *QueryResponse) bool {
+	if c == nil {
+		return true
+	}
+
+	if resp.Status != QueryResponseAvailable && resp.Status != QueryResponseAvailableLater {
+		return true
+	}
+
+	if c.MaxPricePerByte != nil && resp.PricePerByte.GreaterThan(*c.MaxPricePerByte) {
+		return false
+	}
+
+	if resp.PaymentInterval < c.MinPaymentInterval {
+		return false
+	}
+
+	if c.MaxPaymentIntervalIncrease != 0 && resp.PaymentIntervalIncrease > c.MaxPaymentIntervalIncrease {
+		return false
+	}
+
+	return true
+}
+
 // Query is submitted by clients and observed by providers
 type Query struct {
-	Params      Params   `json:"params"`      // Requested data
-	ClientAddrs []string `json:"clientAddrs"` // List of multiaddrs of the client
+	ID          QueryID      `json:"id"`                    // Unique ID of the query
+	Params      Params       `json:"params"`                // Requested data
+	ClientAddrs []string     `json:"clientAddrs"`           // List of multiaddrs of the client
+	Constraints *Constraints `json:"constraints,omitempty"` // Limits on the terms the client will accept, optional
+	Key         []byte       `json:"key,omitempty"`         // Marshalled public key of the client, if signed
+	Signature   []byte       `json:"signature,omitempty"`   // Client's signature over the query, optional
 }
 
 // Marshal returns the JSON marshalled Query
@@ -49,14 +106,54 @@ func (q *Query) Unmarshal(bz []byte) error {
 	return json.Unmarshal(bz, q)
 }
 
+// QueryResponseStatus indicates whether a provider has the requested data
+type QueryResponseStatus uint64
+
+const (
+	// QueryResponseAvailable indicates the provider has the requested data
+	QueryResponseAvailable QueryResponseStatus = iota
+
+	// QueryResponseUnavailable indicates the provider does not have the requested data.
+	// It is only sent in response to direct queries.
+	QueryResponseUnavailable
+
+	// QueryResponseAvailableLater indicates the provider will have the requested data after
+	// the response's ETA, for example once it has been unsealed
+	QueryResponseAvailableLater
+
+	// QueryResponsePriceOnRequest indicates the provider has the requested data, but the terms
+	// of retrieval must be negotiated with it directly
+	QueryResponsePriceOnRequest
+)
+
+func (s QueryResponseStatus) String() string {
+	switch s {
+	case QueryResponseAvailable:
+		return "available"
+	case QueryResponseUnavailable:
+		return "unavailable"
+	case QueryResponseAvailableLater:
+		return "available later"
+	case QueryResponsePriceOnRequest:
+		return "price on request"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint64(s))
+	}
+}
+
 // QueryResponse is returned from a provider to a client if the provider has the requested data
 type QueryResponse struct {
-	Params Params `json:"params"` // Requested data
+	ID     QueryID             `json:"id"`     // ID of the query being responded to
+	Params Params              `json:"params"` // Requested data
+	Status QueryResponseStatus `json:"status"`
+	ETA    uint64              `json:"eta,omitempty"` // Seconds until the data is available, for QueryResponseAvailableLater
 	// TODO: Do we need their FIL address as well?
 	Provider                peer.ID         `json:"provider"` // List of multiaddrs of the provider
 	PricePerByte            abi.TokenAmount `json:"pricePerByte"`
 	PaymentInterval         uint64          `json:"paymentInterval"`
 	PaymentIntervalIncrease uint64          `json:"paymentIntervalIncrease"`
+	Key                     []byte          `json:"key,omitempty"`       // Marshalled public key of the provider
+	Signature               []byte          `json:"signature,omitempty"` // Provider's signature over the response
 }
 
 // Marshal returns the JSON marshalled QueryResponse
@@ -70,8 +167,11 @@ func (q *QueryResponse) Unmarshal(bz []byte) error {
 }
 
 func (q *QueryResponse) String() string {
-	return fmt.Sprintf("params=%v provider=%s pricePerByte=%d paymentInterval=%d paymentIntervalIncrease=%d",
+	return fmt.Sprintf("id=%s params=%v status=%s eta=%ds provider=%s pricePerByte=%d paymentInterval=%d paymentIntervalIncrease=%d",
+		q.ID,
 		q.Params,
+		q.Status,
+		q.ETA,
 		q.Provider,
 		q.PricePerByte,
 		q.PaymentInterval,
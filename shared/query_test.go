@@ -0,0 +1,51 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package shared
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstraints_Accepts(t *testing.T) {
+	maxPrice := abi.NewTokenAmount(2)
+	constraints := &Constraints{
+		MaxPricePerByte:            &maxPrice,
+		MinPaymentInterval:         10,
+		MaxPaymentIntervalIncrease: 100,
+	}
+
+	newResponse := func(status QueryResponseStatus, price int64, interval, increase uint64) *QueryResponse {
+		return &QueryResponse{
+			Status:                  status,
+			PricePerByte:            abi.NewTokenAmount(price),
+			PaymentInterval:         interval,
+			PaymentIntervalIncrease: increase,
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		constraints *Constraints
+		resp        *QueryResponse
+		accepted    bool
+	}{
+		{"within constraints", constraints, newResponse(QueryResponseAvailable, 2, 10, 100), true},
+		{"price too high", constraints, newResponse(QueryResponseAvailable, 3, 10, 100), false},
+		{"interval too low", constraints, newResponse(QueryResponseAvailable, 2, 9, 100), false},
+		{"increase too high", constraints, newResponse(QueryResponseAvailable, 2, 10, 101), false},
+		{"available later", constraints, newResponse(QueryResponseAvailableLater, 3, 10, 100), false},
+		{"price on request", constraints, newResponse(QueryResponsePriceOnRequest, 0, 0, 0), true},
+		{"no max increase", &Constraints{}, newResponse(QueryResponseAvailable, 3, 0, 1000), true},
+		{"nil constraints", nil, newResponse(QueryResponseAvailable, 3, 0, 1000), true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.accepted, tc.constraints.Accepts(tc.resp))
+		})
+	}
+}
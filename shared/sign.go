@@ -0,0 +1,133 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package shared
+
+import (
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// SigningBytes returns the bytes of the Query that are covered by its signature.
+// Empty ClientAddrs are signed as nil, since the CBOR codec doesn't distinguish them, so the signature
+// of a client without listen addrs survives a CBOR round trip.
+func (q *Query) SigningBytes() ([]byte, error) {
+	unsigned := *q
+	unsigned.Key = nil
+	unsigned.Signature = nil
+	if len(unsigned.ClientAddrs) == 0 {
+		unsigned.ClientAddrs = nil
+	}
+	return unsigned.Marshal()
+}
+
+// Sign signs the query with the client's private key
+func (q *Query) Sign(key crypto.PrivKey) error {
+	var err error
+	q.Key, q.Signature, err = sign(q, key)
+	return err
+}
+
+// Signed returns true if the query carries a signature
+func (q *Query) Signed() bool {
+	return len(q.Signature) != 0
+}
+
+// Verify checks that the query is signed by the peer that owns all of its ClientAddrs
+func (q *Query) Verify() error {
+	signer, err := verify(q, q.Key, q.Signature)
+	if err != nil {
+		return err
+	}
+
+	addrs, err := StringsToAddrInfos(q.ClientAddrs)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		if addr.ID != signer {
+			return ErrSignerMismatch
+		}
+	}
+
+	return nil
+}
+
+// SigningBytes returns the bytes of the QueryResponse that are covered by its signature
+func (q *QueryResponse) SigningBytes() ([]byte, error) {
+	unsigned := *q
+	unsigned.Key = nil
+	unsigned.Signature = nil
+	return unsigned.Marshal()
+}
+
+// Sign signs the response with the provider's private key
+func (q *QueryResponse) Sign(key crypto.PrivKey) error {
+	var err error
+	q.Key, q.Signature, err = sign(q, key)
+	return err
+}
+
+// Verify checks that the response is signed by its Provider
+func (q *QueryResponse) Verify() error {
+	signer, err := verify(q, q.Key, q.Signature)
+	if err != nil {
+		return err
+	}
+
+	if signer != q.Provider {
+		return ErrSignerMismatch
+	}
+
+	return nil
+}
+
+type signable interface {
+	SigningBytes() ([]byte, error)
+}
+
+// sign returns the marshalled public key and the signature over msg's signing bytes
+func sign(msg signable, key crypto.PrivKey) ([]byte, []byte, error) {
+	bz, err := msg.SigningBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sig, err := key.Sign(bz)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pub, err := crypto.MarshalPublicKey(key.GetPublic())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pub, sig, nil
+}
+
+// verify checks sig over msg's signing bytes and returns the peer ID of the signer
+func verify(msg signable, key, sig []byte) (peer.ID, error) {
+	if len(sig) == 0 {
+		return "", ErrUnsigned
+	}
+
+	pub, err := crypto.UnmarshalPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	bz, err := msg.SigningBytes()
+	if err != nil {
+		return "", err
+	}
+
+	// some key types return an error rather than false for a bad signature
+	ok, err := pub.Verify(bz, sig)
+	if err != nil || !ok {
+		return "", ErrInvalidSignature
+	}
+
+	return peer.IDFromPublicKey(pub)
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package shared
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+var testCid, _ = cid.Decode("bafybeierhgbz4zp2x2u67urqrgfnrnlukciupzenpqpipiz5nwtq7uxpx4")
+
+func newTestKey(t *testing.T) (crypto.PrivKey, peer.ID) {
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(key)
+	require.NoError(t, err)
+	return key, id
+}
+
+func TestQuery_SignAndVerify(t *testing.T) {
+	key, id := newTestKey(t)
+	query := &Query{
+		ID:          NewQueryID(),
+		Params:      Params{PayloadCID: testCid},
+		ClientAddrs: []string{"/ip4/1.2.3.4/tcp/5678/p2p/" + id.String()},
+	}
+	require.False(t, query.Signed())
+	require.Equal(t, ErrUnsigned, query.Verify())
+
+	err := query.Sign(key)
+	require.NoError(t, err)
+	require.True(t, query.Signed())
+	require.NoError(t, query.Verify())
+
+	// signature must survive a marshalling round trip
+	bz, err := query.Marshal()
+	require.NoError(t, err)
+	decoded := new(Query)
+	err = decoded.Unmarshal(bz)
+	require.NoError(t, err)
+	require.NoError(t, decoded.Verify())
+
+	// tampering with the query invalidates the signature
+	decoded.ID = NewQueryID()
+	require.Equal(t, ErrInvalidSignature, decoded.Verify())
+
+	// signing with a key that does not own the client addrs fails verification
+	other, _ := newTestKey(t)
+	err = query.Sign(other)
+	require.NoError(t, err)
+	require.Equal(t, ErrSignerMismatch, query.Verify())
+}
+
+func TestQuery_SignAndVerify_NoClientAddrs(t *testing.T) {
+	key, _ := newTestKey(t)
+	query := &Query{
+		ID:          NewQueryID(),
+		Params:      Params{PayloadCID: testCid},
+		ClientAddrs: []string{},
+	}
+	require.NoError(t, query.Sign(key))
+	require.NoError(t, query.Verify())
+
+	// the CBOR codec decodes empty ClientAddrs as nil, which must not invalidate the signature
+	var buf bytes.Buffer
+	require.NoError(t, query.MarshalCBOR(&buf))
+	decoded := new(Query)
+	require.NoError(t, decoded.UnmarshalCBOR(&buf))
+	require.Nil(t, decoded.ClientAddrs)
+	require.NoError(t, decoded.Verify())
+
+	// and so must a JSON round trip
+	bz, err := query.Marshal()
+	require.NoError(t, err)
+	decoded = new(Query)
+	require.NoError(t, decoded.Unmarshal(bz))
+	require.NoError(t, decoded.Verify())
+}
+
+func TestQueryResponse_SignAndVerify(t *testing.T) {
+	// RSA peer IDs do not embed the public key, so the key must be carried in the response
+	key, _, err := crypto.GenerateRSAKeyPair(2048, rand.Reader)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(key)
+	require.NoError(t, err)
+
+	resp := &QueryResponse{
+		ID:                      NewQueryID(),
+		Params:                  Params{PayloadCID: testCid},
+		Provider:                id,
+		PricePerByte:            abi.NewTokenAmount(2),
+		PaymentInterval:         1 << 20,
+		PaymentIntervalIncrease: 1 << 20,
+	}
+	require.Equal(t, ErrUnsigned, resp.Verify())
+
+	err = resp.Sign(key)
+	require.NoError(t, err)
+	require.NoError(t, resp.Verify())
+
+	bz, err := resp.Marshal()
+	require.NoError(t, err)
+	decoded := new(QueryResponse)
+	err = decoded.Unmarshal(bz)
+	require.NoError(t, err)
+	require.NoError(t, decoded.Verify())
+
+	decoded.PricePerByte = abi.NewTokenAmount(1)
+	require.Equal(t, ErrInvalidSignature, decoded.Verify())
+
+	// a response signed by a different peer than its Provider is rejected
+	other, _ := newTestKey(t)
+	err = resp.Sign(other)
+	require.NoError(t, err)
+	require.Equal(t, ErrSignerMismatch, resp.Verify())
+}
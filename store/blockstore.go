@@ -0,0 +1,166 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package store
+
+import (
+	"sync"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipfs/go-ipld-format"
+
+	// registers the dag-pb, raw and dag-cbor block decoders used to walk DAGs
+	_ "github.com/ipfs/go-merkledag"
+)
+
+var pieceIndexPrefix = ds.NewKey("/pieces")
+
+// BlockstoreStore is a provider.RetrievalProviderStore backed by a blockstore.
+// Queries for a payload CID are answered from the blockstore, optionally requiring that every block in the
+// DAG rooted at the payload CID is present. Queries that also specify a piece CID additionally require the
+// payload to have been added to that piece's index with AddPiece.
+type BlockstoreStore struct {
+	bs      blockstore.Blockstore
+	index   ds.Datastore
+	walkDAG bool
+	lock    sync.RWMutex
+}
+
+// NewBlockstoreStore returns a BlockstoreStore backed by the given blockstore, which stores its
+// piece CID to payload CID index in the given datastore. If the datastore is nil, an in-memory
+// datastore is used.
+func NewBlockstoreStore(bs blockstore.Blockstore, index ds.Datastore) (*BlockstoreStore, error) {
+	if bs == nil {
+		return nil, ErrNilBlockstore
+	}
+
+	if index == nil {
+		index = ds.NewMapDatastore()
+	}
+
+	return &BlockstoreStore{
+		bs:    bs,
+		index: namespace.Wrap(index, pieceIndexPrefix),
+	}, nil
+}
+
+// SetWalkDAG sets whether Has checks that every block in the DAG rooted at the payload CID is present,
+// rather than only the root block. Walking the DAG decodes every block, so it is disabled by default.
+func (s *BlockstoreStore) SetWalkDAG(walk bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.walkDAG = walk
+}
+
+// AddPiece records that the piece with the given CID contains the payload with the given CID
+func (s *BlockstoreStore) AddPiece(piece, payload cid.Cid) error {
+	return s.index.Put(pieceKey(piece, payload), []byte{})
+}
+
+// RemovePiece removes the payload with the given CID from the index of the piece with the given CID
+func (s *BlockstoreStore) RemovePiece(piece, payload cid.Cid) error {
+	return s.index.Delete(pieceKey(piece, payload))
+}
+
+// CIDs returns the piece CIDs in the index and the payload CIDs added to them with AddPiece.
+// The blockstore can't tell payload roots apart from other blocks, so payloads that aren't in any
+// piece aren't listed.
+func (s *BlockstoreStore) CIDs() []cid.Cid {
+	res, err := s.index.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		log.Error("failed to query piece index; error: ", err)
+		return nil
+	}
+
+	entries, err := res.Rest()
+	if err != nil {
+		log.Error("failed to query piece index; error: ", err)
+		return nil
+	}
+
+	set := cid.NewSet()
+	for _, e := range entries {
+		for _, str := range ds.NewKey(e.Key).Namespaces() {
+			c, err := cid.Decode(str)
+			if err != nil {
+				log.Warn("skipping invalid cid ", str, " in piece index; error: ", err)
+				continue
+			}
+			set.Add(c)
+		}
+	}
+
+	return set.Keys()
+}
+
+// Has returns whether the store has the data requested by the params
+func (s *BlockstoreStore) Has(params shared.Params) (bool, error) {
+	if params.PieceCID != nil {
+		has, err := s.index.Has(pieceKey(*params.PieceCID, params.PayloadCID))
+		if err != nil || !has {
+			return false, err
+		}
+	}
+
+	s.lock.RLock()
+	walk := s.walkDAG
+	s.lock.RUnlock()
+
+	if !walk {
+		return s.bs.Has(params.PayloadCID)
+	}
+
+	return s.hasDAG(params.PayloadCID)
+}
+
+// hasDAG returns whether every block in the DAG rooted at the given CID is in the blockstore
+func (s *BlockstoreStore) hasDAG(root cid.Cid) (bool, error) {
+	visited := cid.NewSet()
+	queue := []cid.Cid{root}
+
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		if !visited.Visit(c) {
+			continue
+		}
+
+		// raw blocks have no links, so it's enough to know they're present
+		if c.Type() == cid.Raw {
+			has, err := s.bs.Has(c)
+			if err != nil || !has {
+				return false, err
+			}
+			continue
+		}
+
+		blk, err := s.bs.Get(c)
+		if err == blockstore.ErrNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		nd, err := ipld.Decode(blk)
+		if err != nil {
+			return false, err
+		}
+
+		for _, l := range nd.Links() {
+			queue = append(queue, l.Cid)
+		}
+	}
+
+	return true, nil
+}
+
+func pieceKey(piece, payload cid.Cid) ds.Key {
+	return ds.NewKey(piece.String()).ChildString(payload.String())
+}
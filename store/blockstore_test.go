@@ -0,0 +1,110 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-merkledag"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBlockstore() blockstore.Blockstore {
+	return blockstore.NewBlockstore(ds.NewMapDatastore())
+}
+
+// newTestDAG returns a root node linking to a raw leaf and an intermediate node,
+// which links to another raw leaf
+func newTestDAG(t *testing.T) (root *merkledag.ProtoNode, mid *merkledag.ProtoNode, leaves []*merkledag.RawNode) {
+	leaves = []*merkledag.RawNode{
+		merkledag.NewRawNode([]byte("noot")),
+		merkledag.NewRawNode([]byte("was")),
+	}
+
+	mid = merkledag.NodeWithData([]byte("here"))
+	require.NoError(t, mid.AddNodeLink("leaf", leaves[1]))
+
+	root = merkledag.NodeWithData([]byte("root"))
+	require.NoError(t, root.AddNodeLink("leaf", leaves[0]))
+	require.NoError(t, root.AddNodeLink("mid", mid))
+	return root, mid, leaves
+}
+
+func TestNewBlockstoreStore(t *testing.T) {
+	_, err := NewBlockstoreStore(nil, nil)
+	require.Equal(t, ErrNilBlockstore, err)
+}
+
+func TestBlockstoreStore_Has(t *testing.T) {
+	bs := newTestBlockstore()
+	s, err := NewBlockstoreStore(bs, nil)
+	require.NoError(t, err)
+
+	root, mid, leaves := newTestDAG(t)
+	params := shared.Params{PayloadCID: root.Cid()}
+
+	has, err := s.Has(params)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	// only the root is required when not walking the DAG
+	require.NoError(t, bs.Put(root))
+	has, err = s.Has(params)
+	require.NoError(t, err)
+	require.True(t, has)
+
+	// every block is required when walking the DAG
+	s.SetWalkDAG(true)
+	require.NoError(t, bs.Put(mid))
+	require.NoError(t, bs.Put(leaves[0]))
+	has, err = s.Has(params)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	require.NoError(t, bs.Put(leaves[1]))
+	has, err = s.Has(params)
+	require.NoError(t, err)
+	require.True(t, has)
+}
+
+func TestBlockstoreStore_PieceIndex(t *testing.T) {
+	bs := newTestBlockstore()
+	s, err := NewBlockstoreStore(bs, ds.NewMapDatastore())
+	require.NoError(t, err)
+
+	payload := merkledag.NewRawNode([]byte("noot"))
+	require.NoError(t, bs.Put(payload))
+
+	piece := merkledag.NewRawNode([]byte("piece")).Cid()
+	otherPiece := merkledag.NewRawNode([]byte("other")).Cid()
+	params := shared.Params{PayloadCID: payload.Cid(), PieceCID: &piece}
+
+	// payload isn't indexed in the piece yet
+	has, err := s.Has(params)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	require.NoError(t, s.AddPiece(piece, payload.Cid()))
+	has, err = s.Has(params)
+	require.NoError(t, err)
+	require.True(t, has)
+
+	// the piece and its payload are listed
+	require.ElementsMatch(t, []cid.Cid{piece, payload.Cid()}, s.CIDs())
+
+	// payload is not in the other piece
+	has, err = s.Has(shared.Params{PayloadCID: payload.Cid(), PieceCID: &otherPiece})
+	require.NoError(t, err)
+	require.False(t, has)
+
+	require.NoError(t, s.RemovePiece(piece, payload.Cid()))
+	has, err = s.Has(params)
+	require.NoError(t, err)
+	require.False(t, has)
+	require.Empty(t, s.CIDs())
+}
@@ -0,0 +1,270 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package store
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	car "github.com/ipld/go-car"
+)
+
+var log = logging.Logger("store")
+
+// CARExtension is the file extension of the CAR files indexed by CARStore
+const CARExtension = ".car"
+
+// DefaultPollInterval is the default interval at which CARStore checks its directory for changes
+var DefaultPollInterval = 10 * time.Second
+
+// carFile is an indexed CAR file
+type carFile struct {
+	modTime time.Time
+	size    int64
+	roots   []cid.Cid
+	cids    []cid.Cid // roots and blocks
+}
+
+// CARStore is a provider.RetrievalProviderStore that indexes the roots and blocks of every CAR file
+// in a directory. While started, it polls the directory and updates its index when CAR files are
+// added, removed or modified.
+// CAR files do not record piece CIDs, so queries are answered by payload CID only, and only the roots are listed
+// by CIDs to be advertised.
+type CARStore struct {
+	dir          string
+	pollInterval time.Duration
+
+	// reloadLock serializes reloads, so files is only modified by the reload holding it, and lock is only
+	// held to check and update the index
+	reloadLock sync.Mutex
+	lock       sync.RWMutex
+	files      map[string]*carFile
+	index      map[cid.Cid]int // number of files containing each cid
+	roots      map[cid.Cid]int // number of files with each root
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewCARStore returns a CARStore with the CAR files in the given directory indexed
+func NewCARStore(dir string) (*CARStore, error) {
+	s := &CARStore{
+		dir:          dir,
+		pollInterval: DefaultPollInterval,
+		files:        make(map[string]*carFile),
+		index:        make(map[cid.Cid]int),
+		roots:        make(map[cid.Cid]int),
+	}
+
+	err := s.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SetPollInterval sets the interval at which the directory is checked for changes once started
+func (s *CARStore) SetPollInterval(interval time.Duration) {
+	s.pollInterval = interval
+}
+
+// Start starts watching the directory for changes
+func (s *CARStore) Start() error {
+	if s.stop != nil {
+		return ErrAlreadyStarted
+	}
+
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go s.watch()
+	return nil
+}
+
+// Stop stops watching the directory
+func (s *CARStore) Stop() error {
+	if s.stop == nil {
+		return nil
+	}
+
+	close(s.stop)
+	s.wg.Wait()
+	s.stop = nil
+	return nil
+}
+
+func (s *CARStore) watch() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := s.Reload()
+			if err != nil {
+				log.Error("failed to reload CAR directory; error: ", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Has returns whether any indexed CAR file contains the requested payload CID
+func (s *CARStore) Has(params shared.Params) (bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.index[params.PayloadCID] > 0, nil
+}
+
+// Len returns the number of distinct CIDs in the index
+func (s *CARStore) Len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return len(s.index)
+}
+
+// CIDs returns the distinct roots of the indexed CAR files. Blocks that aren't roots can still be queried,
+// but aren't listed.
+func (s *CARStore) CIDs() []cid.Cid {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	cids := make([]cid.Cid, 0, len(s.roots))
+	for c := range s.roots {
+		cids = append(cids, c)
+	}
+	return cids
+}
+
+// Reload updates the index from the directory, reading CAR files that are new or have been modified
+// since they were last indexed, and removing files that no longer exist. Files that fail to be read
+// are logged and indexed as empty until they are modified again.
+func (s *CARStore) Reload() error {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]os.FileInfo)
+	for _, info := range infos {
+		if info.Mode().IsRegular() && filepath.Ext(info.Name()) == CARExtension {
+			found[filepath.Join(s.dir, info.Name())] = info
+		}
+	}
+
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+
+	s.lock.RLock()
+	files := make(map[string]*carFile, len(s.files))
+	for path, f := range s.files {
+		files[path] = f
+	}
+	s.lock.RUnlock()
+
+	// read changed files without holding the lock, so queries aren't blocked
+	changed := make(map[string]*carFile)
+	for path, info := range found {
+		if f, has := files[path]; has && f.modTime.Equal(info.ModTime()) && f.size == info.Size() {
+			continue
+		}
+
+		roots, cids, err := readCARFile(path)
+		if err != nil {
+			log.Error("failed to read CAR file ", path, "; error: ", err)
+		}
+
+		changed[path] = &carFile{
+			modTime: info.ModTime(),
+			size:    info.Size(),
+			roots:   roots,
+			cids:    cids,
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for path, f := range s.files {
+		if _, has := found[path]; has && changed[path] == nil {
+			continue
+		}
+
+		s.removeFromIndex(f)
+		delete(s.files, path)
+		log.Debug("removed CAR file ", path, " from index")
+	}
+
+	for path, f := range changed {
+		for _, c := range f.cids {
+			s.index[c]++
+		}
+		for _, c := range f.roots {
+			s.roots[c]++
+		}
+		s.files[path] = f
+		log.Debug("indexed CAR file ", path, " with ", len(f.cids), " cids")
+	}
+
+	return nil
+}
+
+func (s *CARStore) removeFromIndex(f *carFile) {
+	for _, c := range f.cids {
+		s.index[c]--
+		if s.index[c] <= 0 {
+			delete(s.index, c)
+		}
+	}
+
+	for _, c := range f.roots {
+		s.roots[c]--
+		if s.roots[c] <= 0 {
+			delete(s.roots, c)
+		}
+	}
+}
+
+// readCARFile returns the roots of a CAR file, and the CIDs of its roots and blocks
+func readCARFile(path string) ([]cid.Cid, []cid.Cid, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	cr, err := car.NewCarReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roots := cr.Header.Roots
+	cids := append([]cid.Cid{}, roots...)
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			return roots, cids, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		cids = append(cids, blk.Cid())
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	car "github.com/ipld/go-car"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCAR writes a CAR file containing a root linking to a leaf, and returns their CIDs
+func writeTestCAR(t *testing.T, path string, data string) (root, leaf cid.Cid) {
+	dag := mdtest.Mock()
+
+	leafNd := merkledag.NewRawNode([]byte(data))
+	rootNd := merkledag.NodeWithData([]byte("root " + data))
+	require.NoError(t, rootNd.AddNodeLink("leaf", leafNd))
+	require.NoError(t, dag.AddMany(context.Background(), []ipld.Node{leafNd, rootNd}))
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, f.Close())
+	}()
+
+	err = car.WriteCar(context.Background(), dag, []cid.Cid{rootNd.Cid()}, f)
+	require.NoError(t, err)
+	return rootNd.Cid(), leafNd.Cid()
+}
+
+func requireHas(t *testing.T, s *CARStore, c cid.Cid, expected bool) {
+	has, err := s.Has(shared.Params{PayloadCID: c})
+	require.NoError(t, err)
+	require.Equal(t, expected, has, c)
+}
+
+func TestCARStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carstore")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	rootA, leafA := writeTestCAR(t, filepath.Join(dir, "a.car"), "noot")
+	rootB, leafB := writeTestCAR(t, filepath.Join(dir, "b.car"), "was")
+
+	// files without the CAR extension are ignored
+	rootC, _ := writeTestCAR(t, filepath.Join(dir, "c.txt"), "here")
+
+	// invalid CAR files are ignored
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "d.car"), []byte("not a car"), 0644))
+
+	s, err := NewCARStore(dir)
+	require.NoError(t, err)
+
+	for _, c := range []cid.Cid{rootA, leafA, rootB, leafB} {
+		requireHas(t, s, c, true)
+	}
+	requireHas(t, s, rootC, false)
+	require.Equal(t, 4, s.Len())
+	// only the roots are listed
+	require.ElementsMatch(t, []cid.Cid{rootA, rootB}, s.CIDs())
+
+	// removed and added files are reflected in the index once reloaded
+	require.NoError(t, os.Remove(filepath.Join(dir, "b.car")))
+	rootE, leafE := writeTestCAR(t, filepath.Join(dir, "e.car"), "again")
+	require.NoError(t, s.Reload())
+
+	requireHas(t, s, rootB, false)
+	requireHas(t, s, leafB, false)
+	requireHas(t, s, rootE, true)
+	requireHas(t, s, leafE, true)
+	require.Equal(t, 4, s.Len())
+	require.ElementsMatch(t, []cid.Cid{rootA, rootE}, s.CIDs())
+}
+
+func TestCARStore_Watch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carstore")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	s, err := NewCARStore(dir)
+	require.NoError(t, err)
+	s.SetPollInterval(10 * time.Millisecond)
+
+	require.NoError(t, s.Start())
+	require.Equal(t, ErrAlreadyStarted, s.Start())
+	defer func() {
+		require.NoError(t, s.Stop())
+	}()
+
+	root, _ := writeTestCAR(t, filepath.Join(dir, "a.car"), "noot")
+	require.Eventually(t, func() bool {
+		has, err := s.Has(shared.Params{PayloadCID: root})
+		return err == nil && has
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "a.car")))
+	require.Eventually(t, func() bool {
+		has, err := s.Has(shared.Params{PayloadCID: root})
+		return err == nil && !has
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCARStore_ConcurrentReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carstore")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	s, err := NewCARStore(dir)
+	require.NoError(t, err)
+
+	// concurrent reloads each see the new file, but it's only indexed once
+	root, leaf := writeTestCAR(t, filepath.Join(dir, "a.car"), "noot")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, s.Reload())
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 2, s.Len())
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "a.car")))
+	require.NoError(t, s.Reload())
+	requireHas(t, s, root, false)
+	requireHas(t, s, leaf, false)
+}
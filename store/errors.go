@@ -0,0 +1,14 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package store
+
+import (
+	"errors"
+)
+
+// ErrNilBlockstore is returned when a store is created without a blockstore
+var ErrNilBlockstore = errors.New("blockstore is nil")
+
+// ErrAlreadyStarted is returned when starting a store that is already watching for changes
+var ErrAlreadyStarted = errors.New("store already started")
@@ -15,6 +15,7 @@ import (
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/network"
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/provider"
 	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/store"
 	block "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
@@ -37,7 +38,7 @@ func newTestNetwork(t *testing.T) *network.Network {
 	require.NoError(t, err)
 
 	t.Cleanup(func() {
-		require.NoError(t, net.Stop())
+		require.NoError(t, net.Stop(context.Background()))
 		require.NoError(t, h.Close())
 	})
 	return net
@@ -48,18 +49,28 @@ func newTestBlockstore() blockstore.Blockstore {
 	return blockstore.NewBlockstore(nds)
 }
 
-type mockRetrievalProviderStore struct {
+type testRetrievalProviderStore struct {
+	*store.BlockstoreStore
 	bs blockstore.Blockstore
 }
 
-func newTestRetrievalProviderStore() *mockRetrievalProviderStore {
-	return &mockRetrievalProviderStore{
-		bs: newTestBlockstore(),
+func newTestRetrievalProviderStore(t *testing.T) *testRetrievalProviderStore {
+	bs := newTestBlockstore()
+	s, err := store.NewBlockstoreStore(bs, nil)
+	require.NoError(t, err)
+
+	return &testRetrievalProviderStore{
+		BlockstoreStore: s,
+		bs:              bs,
 	}
 }
 
-func (s *mockRetrievalProviderStore) Has(params shared.Params) (bool, error) {
-	return s.bs.Has(params.PayloadCID)
+// requireVerified asserts that the response is signed by its provider and strips the signature
+// so the response can be compared with an expected unsigned response
+func requireVerified(t *testing.T, resp *shared.QueryResponse) {
+	require.NoError(t, resp.Verify())
+	resp.Key = nil
+	resp.Signature = nil
 }
 
 type basicTester struct {
@@ -93,9 +104,9 @@ func TestMain(m *testing.M) {
 func TestBasic(t *testing.T) {
 	pnet := newTestNetwork(t)
 	cnet := newTestNetwork(t)
-	s := newTestRetrievalProviderStore()
+	s := newTestRetrievalProviderStore(t)
 
-	err := pnet.Connect(cnet.AddrInfo())
+	err := pnet.Connect(context.Background(), cnet.AddrInfo())
 	require.NoError(t, err)
 
 	p := provider.NewProvider(pnet, s, cache.NewMockCache(0))
@@ -110,24 +121,29 @@ func TestBasic(t *testing.T) {
 	params := shared.Params{PayloadCID: testCid}
 
 	// start provider
-	err = p.Start()
+	err = p.Start(context.Background())
 	require.NoError(t, err)
 
 	// start client
-	err = c.Start()
+	err = c.Start(context.Background())
 	require.NoError(t, err)
 
 	// subscribe to responses
 	bt := newBasicTester()
-	unsubscribe := c.SubscribeToQueryResponses(bt.handleResponse, params)
+	id := shared.NewQueryID()
+	unsubscribe := c.SubscribeToQueryResponses(bt.handleResponse, id)
 	defer unsubscribe()
 
+	// wait for the provider's topic subscription to reach the client
+	time.Sleep(time.Second)
+
 	// submit query
-	err = c.SubmitQuery(context.Background(), params)
+	err = c.SubmitQuery(context.Background(), id, params)
 	require.NoError(t, err)
 
 	// assert response was received
 	expected := &shared.QueryResponse{
+		ID:                      id,
 		Params:                  params,
 		Provider:                pnet.PeerID(),
 		PricePerByte:            provider.DefaultPricePerByte,
@@ -138,6 +154,7 @@ func TestBasic(t *testing.T) {
 	select {
 	case resp := <-bt.respCh:
 		require.NotNil(t, resp)
+		requireVerified(t, resp)
 		require.Equal(t, expected, resp)
 	case <-time.After(testTimeout):
 		t.Fatal("did not receive response")
@@ -165,7 +182,7 @@ func TestMulti(t *testing.T) {
 		net := newTestNetwork(t)
 		c := client.NewClient(net)
 
-		err := c.Start()
+		err := c.Start(context.Background())
 		require.NoError(t, err)
 
 		clients[i] = c
@@ -175,10 +192,10 @@ func TestMulti(t *testing.T) {
 	// create and start providers
 	for i := 0; i < numProviders; i++ {
 		net := newTestNetwork(t)
-		s := newTestRetrievalProviderStore()
+		s := newTestRetrievalProviderStore(t)
 		p := provider.NewProvider(net, s, cache.NewMockCache(0))
 
-		err := p.Start()
+		err := p.Start(context.Background())
 		require.NoError(t, err)
 
 		providers[i] = p
@@ -189,7 +206,7 @@ func TestMulti(t *testing.T) {
 	// connect clients to providers
 	for _, cnet := range cnets {
 		for _, pnet := range pnets {
-			err := pnet.Connect(cnet.AddrInfo())
+			err := pnet.Connect(context.Background(), cnet.AddrInfo())
 			require.NoError(t, err)
 		}
 	}
@@ -211,15 +228,17 @@ func TestMulti(t *testing.T) {
 
 		// subscribe to responses
 		bt := newBasicTester()
-		unsubscribe := c.SubscribeToQueryResponses(bt.handleResponse, params)
+		id := shared.NewQueryID()
+		unsubscribe := c.SubscribeToQueryResponses(bt.handleResponse, id)
 		defer unsubscribe()
 
 		// submit query
-		err := c.SubmitQuery(context.Background(), params)
+		err := c.SubmitQuery(context.Background(), id, params)
 		require.NoError(t, err)
 
 		// assert response was received
 		expected := &shared.QueryResponse{
+			ID:                      id,
 			Params:                  params,
 			Provider:                pnets[i].PeerID(),
 			PricePerByte:            provider.DefaultPricePerByte,
@@ -230,6 +249,7 @@ func TestMulti(t *testing.T) {
 		select {
 		case resp := <-bt.respCh:
 			require.NotNil(t, resp)
+			requireVerified(t, resp)
 			require.Equal(t, expected, resp)
 		case <-time.After(testTimeout):
 			t.Fatal("did not receive response")
@@ -245,14 +265,14 @@ func TestMultiProvider(t *testing.T) {
 	pnet0 := newTestNetwork(t)
 	pnet1 := newTestNetwork(t)
 	cnet := newTestNetwork(t)
-	s0 := newTestRetrievalProviderStore()
-	s1 := newTestRetrievalProviderStore()
+	s0 := newTestRetrievalProviderStore(t)
+	s1 := newTestRetrievalProviderStore(t)
 
-	err := pnet0.Connect(cnet.AddrInfo())
+	err := pnet0.Connect(context.Background(), cnet.AddrInfo())
 	require.NoError(t, err)
-	err = pnet1.Connect(cnet.AddrInfo())
+	err = pnet1.Connect(context.Background(), cnet.AddrInfo())
 	require.NoError(t, err)
-	err = pnet1.Connect(pnet0.AddrInfo())
+	err = pnet1.Connect(context.Background(), pnet0.AddrInfo())
 	require.NoError(t, err)
 
 	require.GreaterOrEqual(t, len(pnet0.Peers()), 2)
@@ -272,13 +292,13 @@ func TestMultiProvider(t *testing.T) {
 	require.NoError(t, err)
 
 	// start providers and client
-	err = p0.Start()
+	err = p0.Start(context.Background())
 	require.NoError(t, err)
 
-	err = p1.Start()
+	err = p1.Start(context.Background())
 	require.NoError(t, err)
 
-	err = c.Start()
+	err = c.Start(context.Background())
 	require.NoError(t, err)
 
 	params := shared.Params{
@@ -287,15 +307,20 @@ func TestMultiProvider(t *testing.T) {
 
 	// query for CID, should receive responses from both providers
 	bt := newBasicTester()
-	unsubscribe := c.SubscribeToQueryResponses(bt.handleResponse, params)
+	id := shared.NewQueryID()
+	unsubscribe := c.SubscribeToQueryResponses(bt.handleResponse, id)
 	defer unsubscribe()
 
+	// wait for the providers' topic subscriptions to reach the client
+	time.Sleep(time.Second)
+
 	// submit query
-	err = c.SubmitQuery(context.Background(), params)
+	err = c.SubmitQuery(context.Background(), id, params)
 	require.NoError(t, err)
 
 	// assert response was received
 	expected := &shared.QueryResponse{
+		ID:                      id,
 		Params:                  params,
 		PricePerByte:            provider.DefaultPricePerByte,
 		PaymentInterval:         provider.DefaultPaymentInterval,
@@ -308,6 +333,7 @@ func TestMultiProvider(t *testing.T) {
 		select {
 		case resp := <-bt.respCh:
 			require.NotNil(t, resp)
+			requireVerified(t, resp)
 			respProvider := resp.Provider
 			resp.Provider = ""
 			require.Equal(t, expected, resp)
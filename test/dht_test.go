@@ -0,0 +1,148 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/cache"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/client"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/network"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/provider"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	block "github.com/ipfs/go-block-format"
+	"github.com/libp2p/go-libp2p-core/peer"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDHT returns a DHT server on the network's host, connected to the given bootstrap node
+func newTestDHT(t *testing.T, n *network.Network, bootstrap *network.Network) *dht.IpfsDHT {
+	d, err := dht.New(context.Background(), n.Host(), dht.Mode(dht.ModeServer))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, d.Close())
+	})
+
+	if bootstrap != nil {
+		require.NoError(t, n.Connect(context.Background(), bootstrap.AddrInfo()))
+
+		// peers are added to the routing table once identify shows they speak the DHT protocol
+		require.Eventually(t, func() bool {
+			return d.RoutingTable().Size() > 0
+		}, testTimeout, 10*time.Millisecond)
+	}
+
+	return d
+}
+
+func TestDHT_QueryProviders(t *testing.T) {
+	b := block.NewBlock([]byte("noot"))
+	other := block.NewBlock([]byte("was"))
+	piece := block.NewBlock([]byte("piece")).Cid()
+
+	// every node joins the DHT through a bootstrap node, so the client isn't connected to any provider
+	bnet := newTestNetwork(t)
+	newTestDHT(t, bnet, nil)
+
+	// two providers have the data and one has something else
+	var pnets []*network.Network
+	for i, data := range []*block.BasicBlock{b, b, other} {
+		pnet := newTestNetwork(t)
+		d := newTestDHT(t, pnet, bnet)
+
+		s := newTestRetrievalProviderStore(t)
+		require.NoError(t, s.bs.Put(data))
+		require.NoError(t, s.AddPiece(piece, data.Cid()))
+
+		p := provider.NewProvider(pnet, s, cache.NewMockCache(0))
+		p.SetPricePerByte(abi.NewTokenAmount(int64(10 - i)))
+		p.SetContentRouting(d, time.Hour)
+		require.NoError(t, p.Start(context.Background()))
+
+		pnets = append(pnets, pnet)
+	}
+
+	cnet := newTestNetwork(t)
+	d := newTestDHT(t, cnet, bnet)
+	c := client.NewClient(cnet)
+	require.NoError(t, c.Start(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	params := shared.Params{PayloadCID: b.Cid()}
+	_, err := c.QueryProviders(ctx, params, client.QueryOptions{})
+	require.Equal(t, client.ErrNoContentRouting, err)
+
+	c.SetContentRouting(d)
+
+	// providers advertise their cids once started, and are found with FindProvidersAsync
+	require.Eventually(t, func() bool {
+		providers, err := c.FindProviders(ctx, params, 0)
+		require.NoError(t, err)
+		return len(providers) == 2
+	}, testTimeout, 100*time.Millisecond)
+
+	providers, err := c.FindProviders(ctx, params, 0)
+	require.NoError(t, err)
+	var found []peer.ID
+	for _, p := range providers {
+		found = append(found, p.ID)
+	}
+	require.ElementsMatch(t, []peer.ID{pnets[0].PeerID(), pnets[1].PeerID()}, found)
+
+	results, err := c.QueryProviders(ctx, params, client.QueryOptions{Timeout: testTimeout})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	// ranked by price, which is lower for the second provider
+	require.Equal(t, pnets[1].PeerID(), results[0].Response.Provider)
+	require.Equal(t, pnets[0].PeerID(), results[1].Response.Provider)
+	for _, res := range results {
+		require.Equal(t, shared.QueryResponseAvailable, res.Response.Status)
+		require.Equal(t, params, res.Response.Params)
+		require.NoError(t, res.Response.Verify())
+	}
+
+	// collection ends once the minimum number of responses is reached
+	results, err = c.QueryProviders(ctx, params, client.QueryOptions{Timeout: testTimeout, MinResponses: 1})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	// no providers advertise this cid
+	results, err = c.QueryProviders(ctx, shared.Params{PayloadCID: block.NewBlock([]byte("here")).Cid()}, client.QueryOptions{Timeout: testTimeout})
+	require.NoError(t, err)
+	require.Empty(t, results)
+
+	// with a piece CID, providers are looked up by the piece, which every provider advertises
+	params = shared.Params{PayloadCID: b.Cid(), PieceCID: &piece}
+	require.Eventually(t, func() bool {
+		providers, err := c.FindProviders(ctx, params, 0)
+		require.NoError(t, err)
+		return len(providers) == 3
+	}, testTimeout, 100*time.Millisecond)
+
+	// the provider with another payload in the piece responds that it's unavailable, which is ranked last
+	results, err = c.QueryProviders(ctx, params, client.QueryOptions{Timeout: testTimeout})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.Equal(t, pnets[2].PeerID(), results[2].Response.Provider)
+	require.False(t, results[2].Available())
+
+	// and doesn't count towards the minimum number of responses
+	results, err = c.QueryProviders(ctx, params, client.QueryOptions{Timeout: testTimeout, MinResponses: 2})
+	require.NoError(t, err)
+	available := 0
+	for i := range results {
+		if results[i].Available() {
+			available++
+		}
+	}
+	require.Equal(t, 2, available)
+}
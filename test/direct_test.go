@@ -0,0 +1,172 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package test
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/cache"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/client"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/network"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/provider"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	block "github.com/ipfs/go-block-format"
+	libp2p "github.com/libp2p/go-libp2p"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectQuery(t *testing.T) {
+	pnet := newTestNetwork(t)
+	cnet := newTestNetwork(t)
+	s := newTestRetrievalProviderStore(t)
+
+	p := provider.NewProvider(pnet, s, cache.NewMockCache(0))
+	c := client.NewClient(cnet)
+
+	// add data block to blockstore
+	b := block.NewBlock([]byte("noot"))
+	err := s.bs.Put(b)
+	require.NoError(t, err)
+
+	err = p.Start(context.Background())
+	require.NoError(t, err)
+
+	err = c.Start(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	// query for data the provider has
+	params := shared.Params{PayloadCID: b.Cid()}
+	resp, err := c.QueryProvider(ctx, pnet.AddrInfo(), params)
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.ID)
+
+	expected := &shared.QueryResponse{
+		ID:                      resp.ID,
+		Params:                  params,
+		Status:                  shared.QueryResponseAvailable,
+		Provider:                pnet.PeerID(),
+		PricePerByte:            provider.DefaultPricePerByte,
+		PaymentInterval:         provider.DefaultPaymentInterval,
+		PaymentIntervalIncrease: provider.DefaultPaymentIntervalIncrease,
+	}
+	requireVerified(t, resp)
+	require.Equal(t, expected, resp)
+
+	// query for data the provider doesn't have
+	params = shared.Params{PayloadCID: block.NewBlock([]byte("was")).Cid()}
+	resp, err = c.QueryProvider(ctx, pnet.AddrInfo(), params)
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.ID)
+
+	expected = &shared.QueryResponse{
+		ID:           resp.ID,
+		Params:       params,
+		Status:       shared.QueryResponseUnavailable,
+		Provider:     pnet.PeerID(),
+		PricePerByte: big.Zero(),
+	}
+	requireVerified(t, resp)
+	require.Equal(t, expected, resp)
+}
+
+func TestDirectQuery_NoListenAddrs(t *testing.T) {
+	pnet := newTestNetwork(t)
+	s := newTestRetrievalProviderStore(t)
+	b := block.NewBlock([]byte("noot"))
+	require.NoError(t, s.bs.Put(b))
+
+	p := provider.NewProvider(pnet, s, cache.NewMockCache(0))
+	require.NoError(t, p.Start(context.Background()))
+
+	// a client behind a NAT has no addrs to put in its queries, which are still signed
+	h, err := libp2p.New(context.Background(), libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	cnet, err := network.NewNetwork(h)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, cnet.Stop(context.Background()))
+	})
+
+	c := client.NewClient(cnet)
+	require.NoError(t, c.Start(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	resp, err := c.QueryProvider(ctx, pnet.AddrInfo(), shared.Params{PayloadCID: b.Cid()})
+	require.NoError(t, err)
+	require.Equal(t, shared.QueryResponseAvailable, resp.Status)
+}
+
+func TestDirectQuery_StalledAndOversized(t *testing.T) {
+	pnet := newTestNetwork(t)
+	cnet := newTestNetwork(t)
+
+	p := provider.NewProvider(pnet, newTestRetrievalProviderStore(t), cache.NewMockCache(0))
+	p.SetResponseTimeout(100 * time.Millisecond)
+	require.NoError(t, p.Start(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	require.NoError(t, cnet.Connect(ctx, pnet.AddrInfo()))
+
+	// a client that never sends its query has its stream reset once the response timeout passes
+	stalled, err := cnet.NewStream(ctx, pnet.PeerID(), shared.JSONVersion.Query)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(stalled)
+	require.Error(t, err)
+
+	// queries larger than the limit are dropped
+	oversized, err := cnet.NewStream(ctx, pnet.PeerID(), shared.JSONVersion.Query)
+	require.NoError(t, err)
+	_, _ = oversized.Write([]byte(`{"id":"` + strings.Repeat("a", provider.DefaultMaxQuerySize) + `"}`))
+	_ = oversized.CloseWrite()
+	_, err = ioutil.ReadAll(oversized)
+	require.Error(t, err)
+
+	// a stalled stream doesn't hold up Stop
+	_, err = cnet.NewStream(ctx, pnet.PeerID(), shared.JSONVersion.Query)
+	require.NoError(t, err)
+	stopCtx, cancelStop := context.WithTimeout(context.Background(), time.Second)
+	defer cancelStop()
+	require.NoError(t, p.Stop(stopCtx))
+	require.NoError(t, stopCtx.Err())
+}
+
+func TestDirectQuery_RateLimit(t *testing.T) {
+	pnet := newTestNetwork(t)
+	cnet := newTestNetwork(t)
+	s := newTestRetrievalProviderStore(t)
+
+	p := provider.NewProvider(pnet, s, cache.NewMockCache(0))
+	p.SetRateLimit(0.001, 1)
+	require.NoError(t, p.Start(context.Background()))
+	defer func() {
+		require.NoError(t, p.Stop(context.Background()))
+	}()
+
+	c := client.NewClient(cnet)
+	require.NoError(t, c.Start(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	// the first query uses the peer's burst, and the next is dropped
+	params := shared.Params{PayloadCID: block.NewBlock([]byte("noot")).Cid()}
+	_, err := c.QueryProvider(ctx, pnet.AddrInfo(), params)
+	require.NoError(t, err)
+
+	_, err = c.QueryProvider(ctx, pnet.AddrInfo(), params)
+	require.Error(t, err)
+	require.Equal(t, uint64(1), p.ThrottledQueries())
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 ChainSafe Systems
+// SPDX-License-Identifier: Apache-2.0, MIT
+
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/cache"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/client"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/provider"
+	"github.com/ChainSafe/fil-secondary-retrieval-markets/shared"
+	block "github.com/ipfs/go-block-format"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersions(t *testing.T) {
+	pnet := newTestNetwork(t)
+	cnet := newTestNetwork(t)
+	s := newTestRetrievalProviderStore(t)
+
+	p := provider.NewProvider(pnet, s, cache.NewMockCache(0))
+	c := client.NewClient(cnet)
+
+	b := block.NewBlock([]byte("noot"))
+	err := s.bs.Put(b)
+	require.NoError(t, err)
+	params := shared.Params{PayloadCID: b.Cid()}
+
+	err = p.Start(context.Background())
+	require.NoError(t, err)
+
+	err = c.Start(context.Background())
+	require.NoError(t, err)
+
+	err = pnet.Connect(context.Background(), cnet.AddrInfo())
+	require.NoError(t, err)
+
+	// wait for the provider's topic subscriptions to reach the client
+	time.Sleep(time.Second)
+
+	// the provider answers queries in every version
+	for _, v := range shared.Versions {
+		c.SetVersion(v)
+
+		bt := newBasicTester()
+		id := shared.NewQueryID()
+		unsubscribe := c.SubscribeToQueryResponses(bt.handleResponse, id)
+
+		err = c.SubmitQuery(context.Background(), id, params)
+		require.NoError(t, err)
+
+		select {
+		case resp := <-bt.respCh:
+			require.NotNil(t, resp)
+			requireVerified(t, resp)
+			require.Equal(t, id, resp.ID)
+			require.Equal(t, pnet.PeerID(), resp.Provider)
+		case <-time.After(testTimeout):
+			t.Fatal("did not receive response for version", v.Topic)
+		}
+		unsubscribe()
+
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		resp, err := c.QueryProvider(ctx, pnet.AddrInfo(), params)
+		cancel()
+		require.NoError(t, err)
+		require.Equal(t, shared.QueryResponseAvailable, resp.Status)
+	}
+}